@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/tueftler/doget/config"
+)
+
+// Credentials authorizes requests using the credentials configured per host,
+// falling back to those found in the netrc file
+type Credentials struct {
+	Hosts map[string]*config.Credential
+	Netrc map[string]*Machine
+}
+
+var variable = regexp.MustCompile(`^\$(\{([A-Za-z_][A-Za-z0-9_]*)\}|([A-Za-z_][A-Za-z0-9_]*))$`)
+
+// New creates credentials from the given hosts and netrc entries
+func New(hosts map[string]*config.Credential, netrc map[string]*Machine) *Credentials {
+	return &Credentials{Hosts: hosts, Netrc: netrc}
+}
+
+// Headers returns the headers to send to a given host, which may include a port
+func (c *Credentials) Headers(host string) (http.Header, error) {
+	if nil == c {
+		return http.Header{}, nil
+	}
+
+	hostname := strings.Split(host, ":")[0]
+	if credential, ok := c.Hosts[host]; ok {
+		return headers(host, credential)
+	} else if credential, ok := c.Hosts[hostname]; ok {
+		return headers(host, credential)
+	}
+
+	result := http.Header{}
+	if machine, ok := c.Netrc[hostname]; ok {
+		result.Set("Authorization", basic(machine.Login, machine.Password))
+	} else if machine, ok := c.Netrc[""]; ok {
+		result.Set("Authorization", basic(machine.Login, machine.Password))
+	}
+	return result, nil
+}
+
+// Authorize adds the headers for the request's host to a given request
+func (c *Credentials) Authorize(req *http.Request) error {
+	headers, err := c.Headers(req.URL.Host)
+	if err != nil {
+		return err
+	}
+
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+	return nil
+}
+
+// Redirect can be used as an http.Client's CheckRedirect function. It makes sure
+// credentials for one host are never sent to another one when being redirected.
+// As the client copies the original request's headers onto every redirect, the
+// credentials of all hosts visited so far are removed before authorizing.
+func (c *Credentials) Redirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return fmt.Errorf("Stopped after 10 redirects")
+	}
+
+	for _, previous := range via {
+		headers, err := c.Headers(previous.URL.Host)
+		if err != nil {
+			return err
+		}
+		for name := range headers {
+			req.Header.Del(name)
+		}
+	}
+	return c.Authorize(req)
+}
+
+// Redact removes passwords from a given URI so it can be displayed
+func Redact(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil || nil == parsed.User {
+		return uri
+	}
+
+	if _, ok := parsed.User.Password(); ok {
+		parsed.User = url.UserPassword(parsed.User.Username(), "xxxxx")
+	}
+	return parsed.String()
+}
+
+// headers computes the headers for a given credential, resolving environment variables
+func headers(host string, credential *config.Credential) (http.Header, error) {
+	result := http.Header{}
+
+	token, err := resolve(host, credential.Token)
+	if err != nil {
+		return nil, err
+	}
+	username, err := resolve(host, credential.Username)
+	if err != nil {
+		return nil, err
+	}
+	password, err := resolve(host, credential.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	if "" != token {
+		result.Set("Authorization", "Bearer "+token)
+	} else if "" != username {
+		result.Set("Authorization", basic(username, password))
+	}
+
+	for name, value := range credential.Headers {
+		resolved, err := resolve(host, value)
+		if err != nil {
+			return nil, err
+		}
+		result.Set(name, resolved)
+	}
+	return result, nil
+}
+
+// resolve returns a given value, or the environment variable it references, e.g. $TOKEN or ${TOKEN}
+func resolve(host, value string) (string, error) {
+	match := variable.FindStringSubmatch(value)
+	if nil == match {
+		return value, nil
+	}
+
+	name := match[2] + match[3]
+	if resolved := os.Getenv(name); "" != resolved {
+		return resolved, nil
+	}
+	return "", fmt.Errorf("Environment variable %s used in credentials for %s is not set", name, host)
+}
+
+func basic(username, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
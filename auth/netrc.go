@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Machine represents an entry in a netrc file
+type Machine struct {
+	Login    string
+	Password string
+}
+
+// NetrcFile returns the location of the netrc file: $NETRC if set, ~/.netrc
+// (Un*x) or %USERPROFILE%\_netrc (Windows) otherwise
+func NetrcFile() string {
+	if file := os.Getenv("NETRC"); "" != file {
+		return file
+	} else if "windows" == runtime.GOOS {
+		return filepath.Join(os.Getenv("USERPROFILE"), "_netrc")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".netrc")
+}
+
+// ParseNetrc parses a netrc file into its entries, keyed by machine name. The
+// default entry is stored under an empty key. A missing file yields no entries.
+func ParseNetrc(file string) (map[string]*Machine, error) {
+	machines := make(map[string]*Machine)
+
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return machines, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var current *Machine
+	lines := strings.Split(string(content), "\n")
+	for i := 0; i < len(lines); i++ {
+		tokens := strings.Fields(lines[i])
+
+		// Macro definitions extend until the next empty line
+		if len(tokens) > 0 && "macdef" == tokens[0] {
+			for i+1 < len(lines) && "" != strings.TrimSpace(lines[i+1]) {
+				i++
+			}
+			continue
+		}
+
+		for j := 0; j < len(tokens); j++ {
+			switch tokens[j] {
+			case "machine":
+				if j+1 < len(tokens) {
+					current = &Machine{}
+					machines[tokens[j+1]] = current
+					j++
+				}
+			case "default":
+				current = &Machine{}
+				machines[""] = current
+			case "login", "password", "account":
+				if j+1 < len(tokens) && nil != current {
+					if "login" == tokens[j] {
+						current.Login = tokens[j+1]
+					} else if "password" == tokens[j] {
+						current.Password = tokens[j+1]
+					}
+					j++
+				}
+			}
+		}
+	}
+
+	return machines, nil
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func netrc(content string, t *testing.T) map[string]*Machine {
+	file, err := ioutil.TempFile("", "netrc")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.Remove(file.Name())
+
+	file.WriteString(content)
+	file.Close()
+
+	machines, err := ParseNetrc(file.Name())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return machines
+}
+
+func Test_parse_missing_netrc(t *testing.T) {
+	machines, err := ParseNetrc("doesNotExist")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual(0, len(machines), t)
+}
+
+func Test_parse_netrc(t *testing.T) {
+	machines := netrc("machine example.com login user password pass\nmachine example.org\n  login other\n  password secret\n", t)
+	assertEqual(&Machine{Login: "user", Password: "pass"}, machines["example.com"], t)
+	assertEqual(&Machine{Login: "other", Password: "secret"}, machines["example.org"], t)
+}
+
+func Test_parse_netrc_default(t *testing.T) {
+	machines := netrc("machine example.com login user password pass\ndefault login anonymous password none\n", t)
+	assertEqual(&Machine{Login: "anonymous", Password: "none"}, machines[""], t)
+}
+
+func Test_parse_netrc_skips_macros(t *testing.T) {
+	machines := netrc("macdef init\nmachine evil.example.com login x password y\n\nmachine example.com login user password pass\n", t)
+	assertEqual(1, len(machines), t)
+	assertEqual(&Machine{Login: "user", Password: "pass"}, machines["example.com"], t)
+}
@@ -0,0 +1,207 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Cache stores trait archives shared between projects, addressed by their SHA256 hash
+type Cache struct {
+	Dir string
+}
+
+// Entry represents a single archive inside the cache
+type Entry struct {
+	Hash     string
+	Path     string
+	Size     int64
+	LastUsed time.Time
+}
+
+const algorithm = "sha256"
+
+var valid = regexp.MustCompile("^" + algorithm + ":[0-9a-f]{64}$")
+
+// New creates a cache in the given directory
+func New(dir string) *Cache {
+	return &Cache{Dir: dir}
+}
+
+// Path returns the path for a given hash, e.g. "sha256:[hex]"
+func (c *Cache) Path(hash string) string {
+	return filepath.Join(c.Dir, algorithm, strings.TrimPrefix(hash, algorithm+":"))
+}
+
+// Contains returns whether an archive with the given hash is present in the cache
+func (c *Cache) Contains(hash string) bool {
+	if !valid.MatchString(hash) {
+		return false
+	}
+
+	_, err := os.Stat(c.Path(hash))
+	return err == nil
+}
+
+// Store adds the given file to the cache under the given hash
+func (c *Cache) Store(file, hash string) error {
+	target := c.Path(hash)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	// Write to temporary file first, then rename, so concurrent readers never see partial archives
+	temp, err := ioutil.TempFile(filepath.Dir(target), ".store")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if err := copyTo(temp, file); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	// Archives may be hardlinked into projects, make sure they're not modified there
+	if err := os.Chmod(temp.Name(), 0444); err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), target)
+}
+
+// Populate places the archive with the given hash at the given destination,
+// hardlinking it if possible and copying it otherwise
+func (c *Cache) Populate(hash, destination string) error {
+	source := c.Path(hash)
+
+	now := time.Now()
+	os.Chtimes(source, now, now)
+
+	os.Remove(destination)
+	if err := os.Link(source, destination); err == nil {
+		return nil
+	}
+
+	out, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return copyTo(out, source)
+}
+
+// List returns all entries in the cache, sorted by their hash
+func (c *Cache) List() ([]*Entry, error) {
+	infos, err := ioutil.ReadDir(filepath.Join(c.Dir, algorithm))
+	if os.IsNotExist(err) {
+		return []*Entry{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*Entry, 0, len(infos))
+	for _, info := range infos {
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+
+		entries = append(entries, &Entry{
+			Hash:     algorithm + ":" + info.Name(),
+			Path:     filepath.Join(c.Dir, algorithm, info.Name()),
+			Size:     info.Size(),
+			LastUsed: info.ModTime(),
+		})
+	}
+
+	sort.Sort(byHash(entries))
+	return entries, nil
+}
+
+// Verify rehashes all entries and returns those whose contents do not match their hash
+func (c *Cache) Verify() ([]*Entry, error) {
+	entries, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+
+	corrupt := make([]*Entry, 0)
+	for _, entry := range entries {
+		f, err := os.Open(entry.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		hash := sha256.New()
+		_, err = io.Copy(hash, f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if entry.Hash != algorithm+":"+hex.EncodeToString(hash.Sum(nil)) {
+			corrupt = append(corrupt, entry)
+		}
+	}
+
+	return corrupt, nil
+}
+
+// Prune removes all entries not used since the given time and returns them
+func (c *Cache) Prune(before time.Time) ([]*Entry, error) {
+	entries, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+
+	pruned := make([]*Entry, 0)
+	for _, entry := range entries {
+		if entry.LastUsed.Before(before) {
+			if err := c.Remove(entry); err != nil {
+				return nil, err
+			}
+			pruned = append(pruned, entry)
+		}
+	}
+
+	return pruned, nil
+}
+
+// Remove removes an entry from the cache
+func (c *Cache) Remove(entry *Entry) error {
+	return os.Remove(entry.Path)
+}
+
+// String creates a string representation of an entry
+func (e *Entry) String() string {
+	return fmt.Sprintf("%s %10.2fkB %s", e.Hash, float64(e.Size)/float64(1024), e.LastUsed.Format("2006-01-02 15:04:05"))
+}
+
+func copyTo(out io.Writer, file string) error {
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
+
+type byHash []*Entry
+
+func (b byHash) Len() int           { return len(b) }
+func (b byHash) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byHash) Less(i, j int) bool { return b[i].Hash < b[j].Hash }
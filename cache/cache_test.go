@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func assertEqual(expect, actual interface{}, t *testing.T) {
+	if !reflect.DeepEqual(expect, actual) {
+		t.Errorf("Items not equal:\nexpected %q\nhave     %q\n", expect, actual)
+	}
+}
+
+// fixture creates a cache in a temporary directory and a file with the given content
+func fixture(content string, t *testing.T) (*Cache, string, string) {
+	dir, err := ioutil.TempDir("", "doget-cache")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	file := filepath.Join(dir, "archive.zip")
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	hash := sha256.Sum256([]byte(content))
+	return New(filepath.Join(dir, "cache")), file, "sha256:" + hex.EncodeToString(hash[:])
+}
+
+func Test_empty_cache(t *testing.T) {
+	cache, file, hash := fixture("test", t)
+	defer os.RemoveAll(filepath.Dir(file))
+
+	entries, err := cache.List()
+	assertEqual(nil, err, t)
+	assertEqual(0, len(entries), t)
+	assertEqual(false, cache.Contains(hash), t)
+}
+
+func Test_store(t *testing.T) {
+	cache, file, hash := fixture("test", t)
+	defer os.RemoveAll(filepath.Dir(file))
+
+	if err := cache.Store(file, hash); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	assertEqual(true, cache.Contains(hash), t)
+	entries, _ := cache.List()
+	assertEqual(1, len(entries), t)
+	assertEqual(hash, entries[0].Hash, t)
+}
+
+func Test_contains_rejects_malformed_hashes(t *testing.T) {
+	cache, file, _ := fixture("test", t)
+	defer os.RemoveAll(filepath.Dir(file))
+
+	assertEqual(false, cache.Contains("sha256:../../etc/passwd"), t)
+}
+
+func Test_populate(t *testing.T) {
+	cache, file, hash := fixture("test", t)
+	defer os.RemoveAll(filepath.Dir(file))
+
+	cache.Store(file, hash)
+	target := filepath.Join(filepath.Dir(file), "populated.zip")
+	if err := cache.Populate(hash, target); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	content, _ := ioutil.ReadFile(target)
+	assertEqual("test", string(content), t)
+}
+
+func Test_verify(t *testing.T) {
+	cache, file, hash := fixture("test", t)
+	defer os.RemoveAll(filepath.Dir(file))
+
+	cache.Store(file, hash)
+	corrupt, err := cache.Verify()
+	assertEqual(nil, err, t)
+	assertEqual(0, len(corrupt), t)
+
+	ioutil.WriteFile(cache.Path(hash), []byte("tampered"), 0644)
+	corrupt, err = cache.Verify()
+	assertEqual(nil, err, t)
+	assertEqual(1, len(corrupt), t)
+}
+
+func Test_prune(t *testing.T) {
+	cache, file, hash := fixture("test", t)
+	defer os.RemoveAll(filepath.Dir(file))
+
+	cache.Store(file, hash)
+	old := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(cache.Path(hash), old, old)
+
+	pruned, err := cache.Prune(time.Now().Add(-24 * time.Hour))
+	assertEqual(nil, err, t)
+	assertEqual(1, len(pruned), t)
+	assertEqual(false, cache.Contains(hash), t)
+}
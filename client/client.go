@@ -0,0 +1,209 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tueftler/doget/auth"
+	"github.com/tueftler/doget/config"
+)
+
+// Options configures timeouts, retries, proxies and TLS as well as the interval
+// after which mutable resources are revalidated and the maximum size of downloads
+// in bytes, 0 meaning unlimited
+type Options struct {
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	Retries        int
+	Backoff        time.Duration
+	Revalidate     time.Duration
+	MaxSize        int64
+	CABundle       string
+	Proxies        map[string]string
+}
+
+// Client performs HTTP requests, authorizing them using the given credentials
+// and retrying on network and server errors
+type Client struct {
+	Options     Options
+	Credentials *auth.Credentials
+	http        *http.Client
+}
+
+// Direct is used in proxy settings to bypass any proxy for a given host
+const Direct = "direct"
+
+// Defaults returns the default options
+func Defaults() Options {
+	return Options{ConnectTimeout: 30 * time.Second, ReadTimeout: 60 * time.Second, Retries: 3, Backoff: time.Second, Revalidate: time.Hour, MaxSize: 1 << 30}
+}
+
+// Configure creates options from the defaults and the given settings
+func Configure(settings config.Http) (Options, error) {
+	options := Defaults()
+	for name, duration := range map[string]struct {
+		value  string
+		target *time.Duration
+	}{
+		"connect-timeout": {settings.ConnectTimeout, &options.ConnectTimeout},
+		"read-timeout":    {settings.ReadTimeout, &options.ReadTimeout},
+		"backoff":         {settings.Backoff, &options.Backoff},
+		"revalidate":      {settings.Revalidate, &options.Revalidate},
+	} {
+		if "" == duration.value {
+			continue
+		}
+
+		parsed, err := time.ParseDuration(duration.value)
+		if err != nil {
+			return options, fmt.Errorf("Malformed %s %q, expected a duration such as 10s", name, duration.value)
+		}
+		*duration.target = parsed
+	}
+
+	if "" != settings.MaxSize {
+		size, err := Size(settings.MaxSize)
+		if err != nil {
+			return options, err
+		}
+		options.MaxSize = size
+	}
+
+	if nil != settings.Retries {
+		options.Retries = *settings.Retries
+	}
+	options.CABundle = settings.CABundle
+	options.Proxies = settings.Proxies
+	return options, nil
+}
+
+// Size parses a size given in bytes or with one of the units kB, MB or GB, e.g. "100MB"
+func Size(input string) (int64, error) {
+	units := map[string]int64{"": 1, "b": 1, "kb": 1 << 10, "mb": 1 << 20, "gb": 1 << 30}
+
+	value := strings.TrimSpace(input)
+	pos := strings.IndexFunc(value, func(r rune) bool { return r < '0' || r > '9' })
+	if -1 == pos {
+		pos = len(value)
+	}
+
+	number, err := strconv.ParseInt(value[0:pos], 10, 64)
+	unit, ok := units[strings.ToLower(strings.TrimSpace(value[pos:]))]
+	if err != nil || !ok {
+		return 0, fmt.Errorf("Malformed size %q, expected a size such as 100MB", input)
+	}
+	return number * unit, nil
+}
+
+// New creates a new client
+func New(options Options, credentials *auth.Credentials) (*Client, error) {
+	c := &Client{Options: options, Credentials: credentials}
+
+	dialer := &net.Dialer{Timeout: options.ConnectTimeout}
+	transport := &http.Transport{
+		Proxy: c.proxy,
+		Dial: func(network, address string) (net.Conn, error) {
+			conn, err := dialer.Dial(network, address)
+			if err != nil {
+				return nil, err
+			}
+			return &idle{Conn: conn, timeout: options.ReadTimeout}, nil
+		},
+		TLSHandshakeTimeout: options.ConnectTimeout,
+	}
+
+	if "" != options.CABundle {
+		pem, err := ioutil.ReadFile(options.CABundle)
+		if err != nil {
+			return nil, err
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in CA bundle %s", options.CABundle)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	c.http = &http.Client{Transport: transport, CheckRedirect: credentials.Redirect}
+	return c, nil
+}
+
+// Proxy returns the proxy configured for a given host, nil if it is to be accessed directly.
+// Hosts without configuration use the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+func (c *Client) Proxy(uri *url.URL) (*url.URL, error) {
+	proxy, ok := c.Options.Proxies[uri.Host]
+	if !ok {
+		proxy, ok = c.Options.Proxies[strings.Split(uri.Host, ":")[0]]
+	}
+
+	if !ok {
+		return http.ProxyFromEnvironment(&http.Request{URL: uri})
+	} else if Direct == proxy || "" == proxy {
+		return nil, nil
+	}
+
+	parsed, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("Malformed proxy %q for %s", auth.Redact(proxy), uri.Host)
+	}
+	return parsed, nil
+}
+
+// Get performs a GET request with the given additional headers. Network errors and
+// server errors are retried using exponential backoff; after the last attempt, the
+// error or server error response is returned.
+func (c *Client) Get(uri string, headers http.Header) (*http.Response, error) {
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+	if err := c.Credentials.Authorize(req); err != nil {
+		return nil, err
+	}
+
+	delay := c.Options.Backoff
+	for attempt := 0; ; attempt++ {
+		resp, err := c.http.Do(req)
+		if attempt >= c.Options.Retries || (err == nil && resp.StatusCode < 500) {
+			return resp, err
+		}
+
+		if err == nil {
+			resp.Body.Close()
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (c *Client) proxy(req *http.Request) (*url.URL, error) {
+	return c.Proxy(req.URL)
+}
+
+// idle wraps a connection, failing reads when no data arrives within the given timeout
+type idle struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (i *idle) Read(b []byte) (int, error) {
+	if i.timeout > 0 {
+		i.Conn.SetReadDeadline(time.Now().Add(i.timeout))
+	}
+	return i.Conn.Read(b)
+}
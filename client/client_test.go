@@ -0,0 +1,212 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tueftler/doget/config"
+)
+
+func assertEqual(expect, actual interface{}, t *testing.T) {
+	if !reflect.DeepEqual(expect, actual) {
+		t.Errorf("Items not equal:\nexpected %q\nhave     %q\n", expect, actual)
+	}
+}
+
+func fast(t *testing.T) *Client {
+	c, err := New(Options{ConnectTimeout: time.Second, ReadTimeout: time.Second, Retries: 2, Backoff: time.Millisecond}, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return c
+}
+
+func Test_defaults(t *testing.T) {
+	options, err := Configure(config.Http{})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual(Defaults(), options, t)
+}
+
+func Test_configure(t *testing.T) {
+	retries := 0
+	options, err := Configure(config.Http{ConnectTimeout: "5s", ReadTimeout: "2m", Retries: &retries, Backoff: "250ms", Revalidate: "10m", MaxSize: "100MB"})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual(Options{ConnectTimeout: 5 * time.Second, ReadTimeout: 2 * time.Minute, Retries: 0, Backoff: 250 * time.Millisecond, Revalidate: 10 * time.Minute, MaxSize: 100 << 20}, options, t)
+}
+
+func Test_configure_malformed_duration(t *testing.T) {
+	_, err := Configure(config.Http{ReadTimeout: "forever"})
+	if err == nil {
+		t.Error("Expected an error")
+		return
+	}
+	assertEqual(`Malformed read-timeout "forever", expected a duration such as 10s`, err.Error(), t)
+}
+
+func Test_size(t *testing.T) {
+	for input, expected := range map[string]int64{"0": 0, "512": 512, "512B": 512, "64kB": 64 << 10, "100MB": 100 << 20, "1 GB": 1 << 30, "2gb": 2 << 30} {
+		size, err := Size(input)
+		if err != nil {
+			t.Error(err.Error())
+			continue
+		}
+		assertEqual(expected, size, t)
+	}
+}
+
+func Test_malformed_size(t *testing.T) {
+	for _, input := range []string{"", "MB", "100TB", "-1", "1.5GB"} {
+		if _, err := Size(input); err == nil {
+			t.Errorf("Expected an error for %q", input)
+		}
+	}
+}
+
+func Test_missing_ca_bundle(t *testing.T) {
+	_, err := New(Options{CABundle: "does-not-exist.pem"}, nil)
+	if err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func Test_get_retries_server_errors(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(503)
+			return
+		}
+		w.Write([]byte("OK"))
+	}))
+	defer server.Close()
+
+	resp, err := fast(t).Get(server.URL, nil)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	resp.Body.Close()
+	assertEqual(200, resp.StatusCode, t)
+	assertEqual(3, attempts, t)
+}
+
+func Test_get_returns_server_error_after_last_attempt(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(500)
+	}))
+	defer server.Close()
+
+	resp, err := fast(t).Get(server.URL, nil)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	resp.Body.Close()
+	assertEqual(500, resp.StatusCode, t)
+	assertEqual(3, attempts, t)
+}
+
+func Test_get_does_not_retry_client_errors(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(404)
+	}))
+	defer server.Close()
+
+	resp, err := fast(t).Get(server.URL, nil)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	resp.Body.Close()
+	assertEqual(404, resp.StatusCode, t)
+	assertEqual(1, attempts, t)
+}
+
+func Test_get_passes_headers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("If-Modified-Since")))
+	}))
+	defer server.Close()
+
+	resp, err := fast(t).Get(server.URL, http.Header{"If-Modified-Since": []string{"Sun, 18 Oct 2026 00:00:00 GMT"}})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	body := make([]byte, 64)
+	n, _ := resp.Body.Read(body)
+	assertEqual("Sun, 18 Oct 2026 00:00:00 GMT", string(body[:n]), t)
+}
+
+func Test_read_timeout(t *testing.T) {
+	done := make(chan bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	c, err := New(Options{ConnectTimeout: time.Second, ReadTimeout: 50 * time.Millisecond}, nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if _, err := c.Get(server.URL, nil); err == nil {
+		t.Error("Expected a timeout")
+	}
+}
+
+func Test_proxy_per_host(t *testing.T) {
+	c := fast(t)
+	c.Options.Proxies = map[string]string{"example.com": "http://proxy.example.com:3128"}
+
+	proxy, err := c.Proxy(&url.URL{Scheme: "https", Host: "example.com"})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual("http://proxy.example.com:3128", proxy.String(), t)
+}
+
+func Test_proxy_per_host_ignores_port(t *testing.T) {
+	c := fast(t)
+	c.Options.Proxies = map[string]string{"example.com": "http://proxy.example.com:3128"}
+
+	proxy, err := c.Proxy(&url.URL{Scheme: "https", Host: "example.com:8443"})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual("http://proxy.example.com:3128", proxy.String(), t)
+}
+
+func Test_direct_bypasses_proxy(t *testing.T) {
+	c := fast(t)
+	c.Options.Proxies = map[string]string{"example.com": Direct}
+
+	proxy, err := c.Proxy(&url.URL{Scheme: "https", Host: "example.com"})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if proxy != nil {
+		t.Errorf("Expected no proxy, have %s", proxy)
+	}
+}
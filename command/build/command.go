@@ -3,29 +3,34 @@ package build
 import (
 	"flag"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/tueftler/doget/command"
+	"github.com/tueftler/doget/config"
 	"github.com/tueftler/doget/docker"
 	"github.com/tueftler/doget/dockerfile"
 )
 
-// BuildCommand is a thin wrapper around transform > docker build > clean
+// BuildCommand is a thin wrapper around transform > docker build > clean. The vendor
+// directory is locked throughout, so concurrent builds cannot remove it while in use.
 type BuildCommand struct {
 	command.Command
-	flags     *flag.FlagSet
-	transform command.Command
-	docker    docker.Client
-	clean     command.Command
+	flags         *flag.FlagSet
+	configuration *config.Configuration
+	transform     command.Command
+	docker        docker.Client
+	clean         command.Command
 }
 
 // NewCommand creates new build command instance
-func NewCommand(name string, transform command.Command, clean command.Command, client docker.Client) *BuildCommand {
+func NewCommand(name string, configuration *config.Configuration, transform command.Command, clean command.Command, client docker.Client) *BuildCommand {
 	return &BuildCommand{
-		flags:     flag.NewFlagSet(name, flag.ExitOnError),
-		transform: transform,
-		docker:    client,
-		clean:     clean,
+		flags:         flag.NewFlagSet(name, flag.ExitOnError),
+		configuration: configuration,
+		transform:     transform,
+		docker:        client,
+		clean:         clean,
 	}
 }
 
@@ -35,13 +40,22 @@ func (b *BuildCommand) Usage() error {
 		return err
 	}
 
-	fmt.Println("Usage: doget build [OPTIONS] PATH | URL | - \n")
-	fmt.Println("Transform, then build an image from Dockerfile and traits\n")
+	fmt.Print("Usage: doget build [OPTIONS] PATH | URL | - \n\n")
+	fmt.Print("Transform, then build an image from Dockerfile and traits\n\n")
 
 	// Make these look like docker build --help output
 	fmt.Println("  --doget-no-cache=false          Do not use cache for traits")
 	fmt.Println("  --doget-in=Dockerfile.in        Input")
 	fmt.Println("  --doget-out=Dockerfile          Output, combine with --file")
+	fmt.Println("  --doget-update-lock=false       Regenerate doget.lock")
+	fmt.Println("  --doget-duplicates=dedupe       Policy for traits included more than once")
+	fmt.Println("  --doget-workers=4               Number of traits to fetch concurrently")
+	fmt.Println("  --doget-offline=false           Refuse network access, use only local traits")
+	fmt.Println("  --doget-vendor-urls=false       Download files added from URLs into the vendor directory")
+	fmt.Println("  --doget-plan=false              Report what would be fetched, do not build")
+	fmt.Println("  --doget-skip-unchanged=true     Do not rewrite the vendor archive if unchanged")
+	fmt.Println("  --doget-vendor-dir=doget_modules Directory to store traits in")
+	fmt.Println("  --doget-storage=zip             Storage format, one of zip, tar, dir or none")
 
 	// Only print flags usage
 	for _, line := range strings.Split(string(output), "\n") {
@@ -62,6 +76,21 @@ func (b *BuildCommand) Run(parser *dockerfile.Parser, args []string) error {
 
 	transformArgs, dockerArgs := split(args)
 
+	// Only report what would be done, without building
+	if planning(transformArgs) {
+		return b.transform.Run(parser, transformArgs)
+	}
+
+	vendor := b.configuration.VendorDir()
+	for _, arg := range forward(transformArgs, "-vendor-dir") {
+		vendor = strings.TrimPrefix(arg, "-vendor-dir=")
+	}
+	lock, err := command.Lock(vendor)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
 	if err := b.transform.Run(parser, transformArgs); err != nil {
 		return err
 	}
@@ -70,21 +99,45 @@ func (b *BuildCommand) Run(parser *dockerfile.Parser, args []string) error {
 		return err
 	}
 
-	if err := b.clean.Run(parser, []string{}); err != nil {
+	if err := b.clean.Run(parser, forward(transformArgs, "-vendor-dir", "-storage")); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// forward selects the given flags and their values from the transform arguments
+func forward(args []string, names ...string) []string {
+	forwarded := []string{}
+	for _, arg := range args {
+		for _, name := range names {
+			if strings.HasPrefix(arg, name+"=") {
+				forwarded = append(forwarded, arg)
+			}
+		}
+	}
+	return forwarded
+}
+
+// planning returns whether the plan flag is given in the transform arguments
+func planning(args []string) bool {
+	enabled := false
+	for _, arg := range args {
+		if "-plan" == arg {
+			enabled = true
+		} else if strings.HasPrefix(arg, "-plan=") {
+			enabled, _ = strconv.ParseBool(strings.TrimPrefix(arg, "-plan="))
+		}
+	}
+	return enabled
+}
+
 func split(args []string) ([]string, []string) {
 	transformArgs := []string{}
 	dockerArgs := []string{}
 	for _, arg := range args {
 		if strings.HasPrefix(arg, "--doget-") {
-			for _, val := range strings.Split(strings.Replace(arg, "--doget", "", 1), "=") {
-				transformArgs = append(transformArgs, val)
-			}
+			transformArgs = append(transformArgs, strings.Replace(arg, "--doget", "", 1))
 		} else {
 			dockerArgs = append(dockerArgs, arg)
 		}
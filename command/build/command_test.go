@@ -2,11 +2,18 @@ package build
 
 import (
 	"errors"
+	"flag"
+	"github.com/tueftler/doget/config"
 	"github.com/tueftler/doget/dockerfile"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
 
+// Keep the lock file guarding the vendor directory out of the working directory
+var configuration = &config.Configuration{Vendor: filepath.Join(os.TempDir(), "doget_modules")}
+
 func assertEqual(expect, actual interface{}, t *testing.T) {
 	if !reflect.DeepEqual(expect, actual) {
 		t.Errorf("Items not equal:\nexpected %q\nhave     %q\n", expect, actual)
@@ -15,7 +22,27 @@ func assertEqual(expect, actual interface{}, t *testing.T) {
 
 func Test_splitArgsRecognizesTransformArgs(t *testing.T) {
 	transformArgs, _ := split([]string{"--doget-no-cache=true", "-t", "foo:bar", "--no-cache=true"})
-	assertEqual([]string{"-no-cache", "true"}, transformArgs, t)
+	assertEqual([]string{"-no-cache=true"}, transformArgs, t)
+}
+
+func Test_splitArgsKeepsValuesOfTransformArgs(t *testing.T) {
+	transformArgs, _ := split([]string{"--doget-plan=false", "--doget-in=Dockerfile.in", "--doget-vendor-dir=a=b", "."})
+	assertEqual([]string{"-plan=false", "-in=Dockerfile.in", "-vendor-dir=a=b"}, transformArgs, t)
+}
+
+func Test_splitArgsForwardsBoolFlagsParseable(t *testing.T) {
+	transformArgs, _ := split([]string{"--doget-plan=false", "--doget-in=Dockerfile.x", "."})
+
+	flags := flag.NewFlagSet("transform", flag.ContinueOnError)
+	plan := flags.Bool("plan", true, "")
+	in := flags.String("in", "Dockerfile.in", "")
+	if err := flags.Parse(transformArgs); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual(false, *plan, t)
+	assertEqual("Dockerfile.x", *in, t)
+	assertEqual(0, flags.NArg(), t)
 }
 
 func Test_splitArgsRecognizesTransformArgWithoutValue(t *testing.T) {
@@ -69,7 +96,7 @@ func Test_dockerBuildNotExecutedWhenTransformFails(t *testing.T) {
 	transform := &mock{executed: false, err: errors.New("an error")}
 	docker := &mock{executed: false}
 	clean := &mock{executed: false}
-	NewCommand("build", transform, clean, docker).Run(dockerfile.NewParser(), []string{"."})
+	NewCommand("build", configuration, transform, clean, docker).Run(dockerfile.NewParser(), []string{"."})
 	assertEqual(false, docker.executed, t)
 	assertEqual(false, clean.executed, t)
 }
@@ -80,14 +107,14 @@ func Test_returnsTransformError(t *testing.T) {
 	docker := &mock{executed: false}
 	clean := &mock{executed: false}
 
-	assertEqual(err, NewCommand("build", transform, clean, docker).Run(dockerfile.NewParser(), []string{"."}), t)
+	assertEqual(err, NewCommand("build", configuration, transform, clean, docker).Run(dockerfile.NewParser(), []string{"."}), t)
 }
 
 func Test_cleanNotExecutedWhenDockerBuildFails(t *testing.T) {
 	transform := &mock{executed: false}
 	docker := &mock{executed: false, err: errors.New("an error")}
 	clean := &mock{executed: false}
-	NewCommand("build", transform, clean, docker).Run(dockerfile.NewParser(), []string{"."})
+	NewCommand("build", configuration, transform, clean, docker).Run(dockerfile.NewParser(), []string{"."})
 	assertEqual(false, clean.executed, t)
 }
 
@@ -97,7 +124,7 @@ func Test_returnsDockerBuildError(t *testing.T) {
 	docker := &mock{executed: false, err: err}
 	clean := &mock{executed: false}
 
-	assertEqual(err, NewCommand("build", transform, clean, docker).Run(dockerfile.NewParser(), []string{"."}), t)
+	assertEqual(err, NewCommand("build", configuration, transform, clean, docker).Run(dockerfile.NewParser(), []string{"."}), t)
 }
 
 func Test_returnsCleanError(t *testing.T) {
@@ -106,19 +133,45 @@ func Test_returnsCleanError(t *testing.T) {
 	docker := &mock{executed: false}
 	clean := &mock{executed: false, err: err}
 
-	assertEqual(err, NewCommand("build", transform, clean, docker).Run(dockerfile.NewParser(), []string{"."}), t)
+	assertEqual(err, NewCommand("build", configuration, transform, clean, docker).Run(dockerfile.NewParser(), []string{"."}), t)
 }
 
 func Test_executedAllWhenNoneFails(t *testing.T) {
 	transform := &mock{executed: false}
 	docker := &mock{executed: false}
 	clean := &mock{executed: false}
-	NewCommand("build", transform, clean, docker).Run(dockerfile.NewParser(), []string{"."})
+	NewCommand("build", configuration, transform, clean, docker).Run(dockerfile.NewParser(), []string{"."})
 	assertEqual(true, transform.executed, t)
 	assertEqual(true, docker.executed, t)
 	assertEqual(true, clean.executed, t)
 }
 
+func Test_onlyTransformExecutedWhenPlanning(t *testing.T) {
+	transform := &mock{executed: false}
+	docker := &mock{executed: false}
+	clean := &mock{executed: false}
+	NewCommand("build", configuration, transform, clean, docker).Run(dockerfile.NewParser(), []string{"--doget-plan", "."})
+	assertEqual(true, transform.executed, t)
+	assertEqual(false, docker.executed, t)
+	assertEqual(false, clean.executed, t)
+}
+
+func Test_notPlanningWhenPlanDisabled(t *testing.T) {
+	transform := &mock{executed: false}
+	docker := &mock{executed: false}
+	clean := &mock{executed: false}
+	NewCommand("build", configuration, transform, clean, docker).Run(dockerfile.NewParser(), []string{"--doget-plan=false", "."})
+	assertEqual(true, transform.executed, t)
+	assertEqual(true, docker.executed, t)
+}
+
+func Test_planning(t *testing.T) {
+	assertEqual(true, planning([]string{"-plan"}), t)
+	assertEqual(true, planning([]string{"-plan=true"}), t)
+	assertEqual(false, planning([]string{"-plan=false"}), t)
+	assertEqual(false, planning([]string{"-in=Dockerfile.in"}), t)
+}
+
 var showsUsage = []struct {
 	args []string
 }{
@@ -133,9 +186,18 @@ func Test_showsUsage(t *testing.T) {
 		docker := &mock{executed: false}
 		clean := &mock{executed: false}
 
-		NewCommand("build", transform, clean, docker).Run(dockerfile.NewParser(), tt.args)
+		NewCommand("build", configuration, transform, clean, docker).Run(dockerfile.NewParser(), tt.args)
 		assertEqual(false, transform.executed, t)
 		assertEqual(false, docker.executed, t)
 		assertEqual(false, clean.executed, t)
 	}
 }
+
+func Test_forwardSelectsGivenFlags(t *testing.T) {
+	forwarded := forward([]string{"-in=Dockerfile.in", "-vendor-dir=third_party", "-clean", "-storage=dir"}, "-vendor-dir", "-storage")
+	assertEqual([]string{"-vendor-dir=third_party", "-storage=dir"}, forwarded, t)
+}
+
+func Test_forwardWithoutFlags(t *testing.T) {
+	assertEqual([]string{}, forward([]string{"-no-cache=true"}, "-vendor-dir", "-storage"), t)
+}
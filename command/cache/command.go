@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/tueftler/doget/cache"
+	"github.com/tueftler/doget/command"
+	"github.com/tueftler/doget/config"
+	"github.com/tueftler/doget/dockerfile"
+)
+
+// CacheCommand allows to list, verify and prune the shared trait cache
+type CacheCommand struct {
+	command.Command
+	flags         *flag.FlagSet
+	configuration *config.Configuration
+}
+
+// NewCommand creates new cache command instance
+func NewCommand(name string, configuration *config.Configuration) *CacheCommand {
+	return &CacheCommand{flags: flag.NewFlagSet(name, flag.ExitOnError), configuration: configuration}
+}
+
+// Run performs action of cache command, one of [list, verify, prune]
+func (c *CacheCommand) Run(parser *dockerfile.Parser, args []string) error {
+	action := "list"
+	if len(args) > 0 {
+		action = args[0]
+		args = args[1:len(args)]
+	}
+
+	olderThan := c.flags.Duration("older-than", 30*24*time.Hour, "Prune entries not used for this duration")
+	c.flags.Parse(args)
+
+	dir := c.configuration.CacheDir()
+	if "" == dir {
+		return fmt.Errorf("Shared cache is disabled, configure it using `cache` in .doget.yml")
+	}
+	shared := cache.New(dir)
+
+	switch action {
+	case "list":
+		entries, err := shared.List()
+		if err != nil {
+			return err
+		}
+
+		var size int64
+		for _, entry := range entries {
+			fmt.Println(entry.String())
+			size += entry.Size
+		}
+		fmt.Printf("%d archives, %.2fkB in %s\n", len(entries), float64(size)/float64(1024), dir)
+		return nil
+
+	case "verify":
+		corrupt, err := shared.Verify()
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range corrupt {
+			fmt.Printf("Removing corrupt %s\n", entry.String())
+			if err := shared.Remove(entry); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("%d corrupt archives removed from %s\n", len(corrupt), dir)
+		return nil
+
+	case "prune":
+		pruned, err := shared.Prune(time.Now().Add(-*olderThan))
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range pruned {
+			fmt.Printf("Pruned %s\n", entry.String())
+		}
+		fmt.Printf("%d archives not used for %s pruned from %s\n", len(pruned), olderThan.String(), dir)
+		return nil
+
+	default:
+		return fmt.Errorf("Unknown action %q, expected one of [list, verify, prune]", action)
+	}
+}
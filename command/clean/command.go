@@ -2,6 +2,7 @@ package clean
 
 import (
 	"flag"
+	"fmt"
 	"os"
 
 	"github.com/tueftler/doget/command"
@@ -12,19 +13,35 @@ import (
 // CleanCommand allows to remove the vendor directory and all of its contents
 type CleanCommand struct {
 	command.Command
-	flags *flag.FlagSet
+	flags         *flag.FlagSet
+	configuration *config.Configuration
 }
 
 // NewCommand creates new clean command instance
-func NewCommand(name string) *CleanCommand {
-	return &CleanCommand{flags: flag.NewFlagSet(name, flag.ExitOnError)}
+func NewCommand(name string, configuration *config.Configuration) *CleanCommand {
+	return &CleanCommand{flags: flag.NewFlagSet(name, flag.ExitOnError), configuration: configuration}
 }
 
-// Run performs action of clean command
+// Run performs action of clean command. The vendor directory is kept if it is
+// used as storage itself, e.g. to be checked in.
 func (c *CleanCommand) Run(parser *dockerfile.Parser, args []string) error {
-	target := config.Vendordir
-	if _, err := os.Stat(target); nil == err {
-		return os.RemoveAll(target)
+	target := c.flags.String("vendor-dir", c.configuration.VendorDir(), "Directory traits are stored in")
+	format := c.flags.String("storage", c.configuration.StorageFormat(), "Format the vendor directory is stored in")
+	c.flags.Parse(args)
+
+	if "dir" == *format {
+		fmt.Fprintf(os.Stderr, "Keeping %s, it is used as storage\n", *target)
+		return nil
+	}
+
+	lock, err := command.Lock(*target)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	if _, err := os.Stat(*target); nil == err {
+		return os.RemoveAll(*target)
 	}
 
 	return nil
@@ -0,0 +1,26 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/tueftler/doget/flock"
+)
+
+// Lock acquires the advisory lock guarding the given vendor directory and its storage
+// against concurrent use by other processes, waiting for it if necessary
+func Lock(vendor string) (*flock.Lock, error) {
+	file := filepath.Clean(vendor) + ".lck"
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return nil, err
+	}
+
+	return flock.Acquire(file, func(pid int) {
+		if pid > 0 {
+			fmt.Fprintf(os.Stderr, "Waiting for lock on %s held by PID %d...\n", vendor, pid)
+		} else {
+			fmt.Fprintf(os.Stderr, "Waiting for lock on %s held by another process...\n", vendor)
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package transform
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Include represents the position of a USE instruction inside a file
+type Include struct {
+	Name string
+	Line int
+}
+
+// Chain is the stack of includes leading to a file
+type Chain []Include
+
+// IncludeError wraps an error raised inside an included file
+type IncludeError struct {
+	Chain Chain
+	Err   error
+}
+
+// CycleError is raised when a trait includes itself, directly or transitively
+type CycleError struct {
+	Chain  Chain
+	Origin string
+}
+
+// String creates a string representation of an include
+func (i Include) String() string {
+	return fmt.Sprintf("%s:%d", i.Name, i.Line)
+}
+
+// Push returns a new chain with the given include appended
+func (c Chain) Push(name string, line int) Chain {
+	result := make(Chain, len(c), len(c)+1)
+	copy(result, c)
+	return append(result, Include{Name: name, Line: line})
+}
+
+// Contains returns whether a given name is part of this chain
+func (c Chain) Contains(name string) bool {
+	for _, include := range c {
+		if include.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// String creates a string representation of the chain, e.g. "Dockerfile.in:3 -> github.com/a/x:4"
+func (c Chain) String() string {
+	includes := make([]string, len(c))
+	for i, include := range c {
+		includes[i] = include.String()
+	}
+	return strings.Join(includes, " -> ")
+}
+
+// Error returns the error message prefixed with the include chain
+func (e *IncludeError) Error() string {
+	return e.Chain.String() + ": " + e.Err.Error()
+}
+
+// Error returns the cycle, e.g. "Dockerfile.in:3 -> github.com/a/x:4 -> github.com/a/x"
+func (e *CycleError) Error() string {
+	return "Include cycle detected: " + e.Chain.String() + " -> " + e.Origin
+}
+
+// wrap attaches the include chain to a given error unless it already carries one
+func wrap(chain Chain, err error) error {
+	switch err.(type) {
+	case *IncludeError, *CycleError:
+		return err
+	default:
+		return &IncludeError{Chain: chain, Err: err}
+	}
+}
@@ -4,9 +4,13 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
-	"strings"
+	"path/filepath"
 
+	"github.com/tueftler/doget/auth"
+	"github.com/tueftler/doget/cache"
+	"github.com/tueftler/doget/client"
 	"github.com/tueftler/doget/command"
 	"github.com/tueftler/doget/config"
 	"github.com/tueftler/doget/dockerfile"
@@ -14,46 +18,130 @@ import (
 
 type TransformCommand struct {
 	command.Command
-	flags *flag.FlagSet
+	flags         *flag.FlagSet
+	configuration *config.Configuration
 }
 
 // Creates new transform command instance
-func NewCommand(name string) *TransformCommand {
-	return &TransformCommand{flags: flag.NewFlagSet(name, flag.ExitOnError)}
+func NewCommand(name string, configuration *config.Configuration) *TransformCommand {
+	return &TransformCommand{flags: flag.NewFlagSet(name, flag.ExitOnError), configuration: configuration}
 }
 
 // Runs transform command
 func (c *TransformCommand) Run(parser *dockerfile.Parser, args []string) error {
 	input := c.flags.String("in", "Dockerfile.in", "Input. Use - for standard input")
 	output := c.flags.String("out", "Dockerfile", "Output. Use - for standard output")
-	performClean := c.flags.Bool("clean", false, "Remove "+config.Vendordir+" directory after transformation")
+	vendor := c.flags.String("vendor-dir", c.configuration.VendorDir(), "Directory to store traits in")
+	format := c.flags.String("storage", c.configuration.StorageFormat(), "Format to store the vendor directory in, one of [zip, tar, dir, none]")
+	performClean := c.flags.Bool("clean", false, "Remove vendor directory after transformation")
 	noCache := c.flags.Bool("no-cache", false, "Do not use cache")
+	updateLock := c.flags.Bool("update-lock", false, "Regenerate "+config.Lockfile+" instead of honoring it")
+	policy := c.flags.String("duplicates", Dedupe, "Policy for traits included more than once, one of [dedupe, warn, error]")
+	workers := c.flags.Int("workers", 4, "Number of traits to fetch concurrently")
+	offline := c.flags.Bool("offline", c.configuration.Offline, "Refuse network access, use only the vendor directory and the shared cache")
+	vendorUrls := c.flags.Bool("vendor-urls", c.configuration.VendorUrls, "Download files added from URLs into the vendor directory")
+	plan := c.flags.Bool("plan", false, "Report traits to be fetched and PROVIDES checks without writing anything")
+	skipUnchanged := c.flags.Bool("skip-unchanged", true, "Do not rewrite the vendor archive if its contents have not changed")
 	c.flags.Parse(args)
 
-	if *performClean {
-		defer os.RemoveAll(config.Vendordir)
+	duplicates, err := NewDuplicates(*policy)
+	if err != nil {
+		return err
+	}
+
+	storage, err := NewStorage(*format, filepath.Clean(*vendor))
+	if err != nil {
+		return err
+	}
+
+	if *offline && *noCache {
+		return fmt.Errorf("Cannot combine -offline and -no-cache")
+	}
+
+	if *performClean && storage.Persistent() {
+		return fmt.Errorf("Cannot combine -clean and -storage=%s", storage.Format)
+	}
+
+	if *performClean && *plan {
+		return fmt.Errorf("Cannot combine -clean and -plan")
+	}
+
+	lock, err := command.Lock(storage.Dir)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	// When planning, traits are fetched into a scratch copy of the vendor directory
+	vendorDir := storage.Dir
+	if *plan {
+		scratch, err := ioutil.TempDir("", "doget-plan")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(scratch)
+
+		if vendorDir, err = storage.Scratch(scratch); err != nil {
+			return err
+		}
+	} else if *performClean {
+		defer os.RemoveAll(storage.Dir)
+	}
+
+	if file := storage.File(); "" != file && !*plan {
+		if _, err := os.Stat(file); err == nil {
+			fmt.Fprint(os.Stderr, "Preparing...")
+			if _, err := storage.Restore(); err != nil {
+				return err
+			}
+			fmt.Fprintln(os.Stderr, " OK")
+		}
 	}
 
-	storage := config.Vendordir + ".zip"
-	if _, err := os.Stat(storage); err == nil {
-		fmt.Fprint(os.Stderr, "Preparing...")
-		if err := unzip(storage, ".", strings.NewReplacer()); err != nil {
+	lockfile := NewLockfile(config.Lockfile)
+	if !*updateLock {
+		if lockfile, err = OpenLockfile(config.Lockfile); err != nil {
 			return err
 		}
-		fmt.Fprintln(os.Stderr, " OK")
 	}
 
 	// Transform
 	var buf bytes.Buffer
-	transformation := Transformation{Input: *input, Output: &buf, UseCache: !*noCache}
-	err := transformation.Run(parser)
+	transformation := Transformation{Input: *input, Output: &buf, Vendor: vendorDir, UseCache: !*noCache, Offline: *offline, VendorUrls: *vendorUrls && !*plan, Lock: lockfile, Duplicates: duplicates, Workers: *workers, Replace: c.configuration.Replace}
+	netrc, err := auth.ParseNetrc(auth.NetrcFile())
+	if err != nil {
+		return err
+	}
+	options, err := client.Configure(c.configuration.Http)
+	if err != nil {
+		return err
+	}
+	if transformation.Client, err = client.New(options, auth.New(c.configuration.Credentials, netrc)); err != nil {
+		return err
+	}
+	if dir := c.configuration.CacheDir(); "" != dir {
+		transformation.Cache = cache.New(dir)
+	}
+
+	if *plan {
+		transformation.Plan = &Plan{}
+		err = transformation.Run(parser)
+		transformation.Plan.Print(os.Stdout)
+		return err
+	}
+	err = transformation.Run(parser)
 
-	if err == nil {
+	if err == nil && "" != storage.File() {
 		fmt.Fprint(os.Stderr, "Caching...")
-		if err := mkzip(config.Vendordir, storage); err != nil {
+		written, err := storage.Save(*skipUnchanged)
+		if err != nil {
 			return err
 		}
-		fmt.Fprintln(os.Stderr, " Done")
+		if written {
+			fmt.Fprintln(os.Stderr, " Done")
+		} else {
+			fmt.Fprintln(os.Stderr, " Unchanged")
+		}
 	}
 
 	if err != nil {
@@ -63,15 +151,7 @@ func (c *TransformCommand) Run(parser *dockerfile.Parser, args []string) error {
 	// Result
 	if *output == "-" {
 		fmt.Println(buf.String())
-	} else {
-		out, err := os.Create(*output)
-		if err != nil {
-			return err
-		}
-
-		defer out.Close()
-		fmt.Fprintf(out, buf.String())
+		return nil
 	}
-
-	return nil
+	return atomically(*output, buf.Bytes())
 }
@@ -3,12 +3,18 @@ package transform
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/tueftler/doget/config"
+	"github.com/tueftler/doget/auth"
+	"github.com/tueftler/doget/cache"
+	"github.com/tueftler/doget/client"
 	"github.com/tueftler/doget/use"
 )
 
@@ -21,87 +27,352 @@ type Track struct {
 
 func (t *Track) Read(p []byte) (int, error) {
 	n, err := t.Reader.Read(p)
-	if n > 0 {
+	if n > 0 && t.progress != nil {
 		t.total += int64(n)
 		t.progress(t.total, t.length)
 	}
 	return n, err
 }
 
-func download(uri, file string, progress func(transferred, total int64)) (int64, error) {
-	client := &http.Client{}
-
-	req, err := http.NewRequest("GET", uri, nil)
+// download fetches the given URI into a file and returns metadata describing the response.
+// The response is written to a temporary file first, which is renamed once complete; if the
+// transfer breaks off, it is resumed using range requests where the server supports them.
+// If metadata from a previous download is given, the request is made conditional, and nil
+// metadata is returned if the server responds with "304 Not Modified".
+func download(uri, file string, cached *Metadata, client *client.Client, progress func(transferred, total int64)) (*Metadata, int64, error) {
+	part := file + ".part"
+	partial, err := ReadMetadata(part + ".meta")
 	if err != nil {
-		return -1, err
+		return nil, -1, err
 	}
 
-	stat, err := os.Stat(file)
-	if err == nil {
-		req.Header.Add("If-Modified-Since", stat.ModTime().UTC().Format(http.TimeFormat))
+	limit := client.Options.MaxSize
+	for attempt := 0; ; attempt++ {
+		headers := http.Header{}
+		offset := int64(0)
+		if stat, err := os.Stat(part); err == nil && nil != partial && "" != partial.validator() {
+			offset = stat.Size()
+			headers.Add("Range", fmt.Sprintf("bytes=%d-", offset))
+			headers.Add("If-Range", partial.validator())
+		} else if nil != cached {
+			if "" != cached.ETag {
+				headers.Add("If-None-Match", cached.ETag)
+			}
+			if "" != cached.LastModified {
+				headers.Add("If-Modified-Since", cached.LastModified)
+			}
+		}
+
+		resp, err := client.Get(uri, headers)
+		if err != nil {
+			return nil, -1, err
+		}
+
+		// DEBUG fmt.Printf("<<< %+v\n", resp)
+
+		switch {
+		case 200 == resp.StatusCode:
+			offset = 0
+			partial = describe(uri, resp)
+			if err := partial.Write(part + ".meta"); err != nil {
+				resp.Body.Close()
+				return nil, -1, err
+			}
+
+		case 206 == resp.StatusCode && strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)):
+			// Resuming
+
+		case 304 == resp.StatusCode && nil != cached && 0 == offset:
+			resp.Body.Close()
+			return nil, 0, nil
+
+		case 416 == resp.StatusCode && offset > 0:
+			resp.Body.Close()
+			os.Remove(part)
+			partial = nil
+			continue
+
+		default:
+			resp.Body.Close()
+			return nil, -1, fmt.Errorf("Could not download %q, response %s", auth.Redact(uri), resp.Status)
+		}
+
+		if limit > 0 && resp.ContentLength > 0 && offset+resp.ContentLength > limit {
+			resp.Body.Close()
+			return nil, -1, exceeds(uri, part, limit)
+		}
+
+		size, err := transfer(resp, part, offset, limit, progress)
+		if limit > 0 && size > limit {
+			return nil, -1, exceeds(uri, part, limit)
+		} else if err != nil && attempt < client.Options.Retries {
+			continue
+		} else if err != nil {
+			return nil, -1, err
+		}
+
+		partial.Fetched = time.Now().UTC()
+		os.Remove(part + ".meta")
+		return partial, size, os.Rename(part, file)
 	}
+}
 
-	// DEBUG fmt.Printf(">>> %+v\n", req)
+// transfer writes a response's body to the given file, appending to it if an offset is
+// given, and returns the file's size. At most one byte more than the limit is written.
+func transfer(resp *http.Response, file string, offset, limit int64, progress func(transferred, total int64)) (int64, error) {
+	defer resp.Body.Close()
 
-	resp, err := client.Do(req)
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if offset > 0 {
+		flags = os.O_WRONLY | os.O_APPEND
+	}
+	out, err := os.OpenFile(file, flags, 0644)
 	if err != nil {
-		return -1, err
+		return offset, err
 	}
-	defer resp.Body.Close()
+	defer out.Close()
 
-	// DEBUG fmt.Printf("<<< %+v\n", resp)
+	var body io.Reader = resp.Body
+	if limit > 0 {
+		body = io.LimitReader(body, limit-offset+1)
+	}
 
-	switch resp.StatusCode {
-	case 200:
-		out, err := os.Create(file)
-		if err != nil {
-			return -1, err
-		}
-		defer out.Close()
+	length := int64(-1)
+	if resp.ContentLength >= 0 {
+		length = offset + resp.ContentLength
+	}
+	size, err := io.Copy(out, &Track{body, offset, length, progress})
+	return offset + size, err
+}
 
-		size, err := io.Copy(out, &Track{resp.Body, 0, resp.ContentLength, progress})
-		if err != nil {
-			return -1, err
-		}
+// describe creates metadata from a given response
+func describe(uri string, resp *http.Response) *Metadata {
+	return &Metadata{
+		Uri:          auth.Redact(uri),
+		Resolved:     auth.Redact(resp.Request.URL.String()),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+}
 
-		return size, nil
+// exceeds removes a partial download and returns an error stating it exceeds the given limit
+func exceeds(uri, part string, limit int64) error {
+	os.Remove(part)
+	os.Remove(part + ".meta")
+	return fmt.Errorf("Could not download %q, exceeds maximum size of %d bytes", auth.Redact(uri), limit)
+}
 
-	case 304:
-		progress(stat.Size(), stat.Size())
-		return stat.Size(), nil
+// Fetched represents a trait stored in the vendor directory
+type Fetched struct {
+	Path     string
+	Revision string
+	Archive  string
+	From     string
+}
+
+// storage returns the directory a trait is stored in inside the given vendor directory, keyed
+// by its version so that multiple versions can coexist, e.g. doget_modules/github.com/thekid/traits/v1.0.0
+func storage(vendor string, origin *use.Origin) string {
+	return filepath.Join(vendor, origin.Host, origin.Vendor, origin.Name, strings.Replace(origin.Version, "/", "-", -1))
+}
+
+// Fetcher fetches traits into the vendor directory
+type Fetcher struct {
+	UseCache   bool
+	Offline    bool
+	Shared     *cache.Cache
+	Client     *client.Client
+	Revalidate time.Duration
+	Progress   func(transferred, total int64)
+	targets    map[string]*target
+	mutex      sync.Mutex
+}
+
+// target serializes fetches into the same location, e.g. of two traits inside the same
+// repository at the same version, and records whether it has already been fetched
+type target struct {
+	sync.Mutex
+	done bool
+}
 
-	default:
-		return -1, fmt.Errorf("Could not download %q, response %+v", uri, resp)
+// guard returns the target for a given location
+func (f *Fetcher) guard(location string) *target {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if nil == f.targets {
+		f.targets = make(map[string]*target)
+	}
+	guarded, ok := f.targets[location]
+	if !ok {
+		guarded = &target{}
+		f.targets[location] = guarded
+	}
+	return guarded
+}
+
+// Fetch downloads the given origin to the target directory unless it is already present there.
+// If the archive's hash is known and the shared cache contains it, it is used instead of downloading.
+// Traits from git repositories are cloned instead, and raw traits consist of their Dockerfile
+// only. In offline mode, a MissingError is returned instead of downloading.
+//
+// How a trait was fetched, including its archive's hash, is recorded in a metadata file
+// next to it, so that traits already present can be verified against it. Traits fetched from
+// branches are revalidated once the Revalidate interval has passed, using conditional
+// requests or, for git repositories, by comparing the branch's commit.
+//
+// Traits sharing a location are fetched one after another, and only once per Fetcher.
+func (f *Fetcher) Fetch(origin *use.Origin, target, hash string) (*Fetched, error) {
+	location := target
+	if use.Raw == origin.Type {
+		location = filepath.Join(target, origin.Dir)
 	}
+
+	guarded := f.guard(location)
+	guarded.Lock()
+	defer guarded.Unlock()
+
+	fetched, err := f.fetch(origin, target, hash, guarded.done)
+	if err == nil {
+		guarded.done = true
+	}
+	return fetched, err
 }
 
-func fetch(origin *use.Origin, useCache bool, progress func(transferred, total int64)) (string, error) {
-	target := filepath.Join(config.Vendordir, origin.Host, origin.Vendor, origin.Name)
-	zip := filepath.Join(target, strings.Replace(origin.Version, "/", "-", -1)+".zip")
+// fetch fetches the given origin unless it is present, or was already fetched before
+func (f *Fetcher) fetch(origin *use.Origin, target, hash string, done bool) (*Fetched, error) {
+	fetched := &Fetched{Path: filepath.Join(target, origin.Dir), Revision: origin.Version, From: "cached"}
+	present, file, sidecar := target, target+".archive", target+".meta"
+	if use.Raw == origin.Type {
+		present = filepath.Join(fetched.Path, "Dockerfile")
+		file = present + ".download"
+		sidecar = present + ".meta"
+	}
 
-	doDownload := !useCache
-	if _, err := os.Stat(target); err != nil {
+	metadata, err := ReadMetadata(sidecar)
+	if err != nil {
+		return nil, err
+	}
+
+	doDownload := !f.UseCache && !done
+	if _, err := os.Stat(present); err != nil {
+		doDownload = true
+		metadata = nil
+	} else if f.UseCache && !f.Offline && !done && metadata.Stale(origin.Version, f.Revalidate, time.Now()) {
 		doDownload = true
 	}
 
-	fmt.Fprintf(os.Stderr, " ---> USE %s\n", origin.String())
-	if doDownload {
-		if err := os.MkdirAll(target, 0755); err != nil {
-			return "", err
+	if !doDownload {
+		if nil != metadata {
+			if "" != metadata.Revision {
+				fetched.Revision = metadata.Revision
+			}
+			fetched.Archive = metadata.Archive
 		}
+		return fetched, nil
+	}
 
-		if _, err := download(origin.Uri, zip, progress); err != nil {
-			return "", err
+	shared := f.Shared != nil && f.Shared.Contains(hash)
+	if f.Offline && !shared {
+		return nil, &MissingError{Origin: origin.String()}
+	}
+
+	if use.Git == origin.Type {
+		if nil != metadata {
+			revision, err := head(origin.Uri, origin.Version, f.Client)
+			if err != nil {
+				return nil, err
+			}
+			if "" != revision && revision == metadata.Revision {
+				metadata.Fetched = time.Now().UTC()
+				fetched.Revision = revision
+				fetched.From = "revalidated"
+				return fetched, metadata.Write(sidecar)
+			}
 		}
 
-		if err := unzip(zip, target, strings.NewReplacer(origin.Name+"-"+origin.Version+"/", "")); err != nil {
-			return "", err
+		revision, err := clone(origin.Uri, origin.Version, target, f.Client)
+		if err != nil {
+			return nil, err
 		}
+		fetched.Revision = revision
+		fetched.From = "cloned"
+
+		metadata = &Metadata{Uri: auth.Redact(origin.Uri), Revision: revision, Fetched: time.Now().UTC()}
+		return fetched, metadata.Write(sidecar)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return nil, err
+	}
 
-		os.Remove(zip)
+	if shared {
+		if err := f.Shared.Populate(hash, file); err != nil {
+			return nil, err
+		}
+		fetched.From = "shared cache"
+		metadata = &Metadata{Uri: auth.Redact(origin.Uri), Fetched: time.Now().UTC()}
+	} else if downloaded, size, err := download(origin.Uri, file, metadata, f.Client, f.Progress); err != nil {
+		return nil, err
+	} else if nil == downloaded {
+		metadata.Fetched = time.Now().UTC()
+		if "" != metadata.Revision {
+			fetched.Revision = metadata.Revision
+		}
+		fetched.Archive = metadata.Archive
+		fetched.From = "revalidated"
+		return fetched, metadata.Write(sidecar)
 	} else {
-		fmt.Fprint(os.Stderr, " ---> (cached)")
+		if f.Progress != nil {
+			fmt.Fprintln(os.Stderr)
+		}
+		fetched.From = fmt.Sprintf("downloaded %.2fkB", float64(size)/float64(1024))
+		metadata = downloaded
 	}
 
-	return filepath.Join(target, origin.Dir), nil
+	archive, err := digest(file)
+	if err != nil {
+		return nil, err
+	}
+	fetched.Archive = archive
+	fetched.Revision = revision(file, origin.Version)
+
+	if f.Shared != nil && !shared {
+		if err := f.Shared.Store(file, archive); err != nil {
+			return nil, err
+		}
+	}
+
+	// Raw traits share their target directory, archives replace its contents
+	if use.Raw == origin.Type {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(present, content, 0644); err != nil {
+			return nil, err
+		}
+	} else if err := os.RemoveAll(target); err != nil {
+		return nil, err
+	} else if err := extract(file, target, origin.Format, origin.Prefix); err != nil {
+		return nil, err
+	}
+	os.Remove(file)
+
+	metadata.Revision = fetched.Revision
+	metadata.Archive = archive
+	return fetched, metadata.Write(sidecar)
+}
+
+// progress displays a progress bar
+func progress(transferred, total int64) {
+	percentage := float64(transferred) / float64(total)
+	finished := int(math.Max(percentage*float64(40), 40))
+	fmt.Fprintf(
+		os.Stderr,
+		"\r ---> Transferring [%s%s] %.2fkB",
+		strings.Repeat("#", finished),
+		strings.Repeat("_", 40-finished),
+		float64(transferred)/float64(1024),
+	)
 }
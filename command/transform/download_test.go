@@ -0,0 +1,305 @@
+package transform
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tueftler/doget/auth"
+	"github.com/tueftler/doget/cache"
+	"github.com/tueftler/doget/client"
+	"github.com/tueftler/doget/config"
+	"github.com/tueftler/doget/dockerfile"
+	"github.com/tueftler/doget/use"
+)
+
+// anonymous creates a client using the default options and no credentials
+func anonymous(t *testing.T) *client.Client {
+	return authenticated(nil, t)
+}
+
+// authenticated creates a client using the default options and the given credentials
+func authenticated(credentials *auth.Credentials, t *testing.T) *client.Client {
+	c, err := client.New(client.Defaults(), credentials)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return c
+}
+
+// archive creates a zip archive with the given files
+func archive(files map[string]string, t *testing.T) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		f.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err.Error())
+	}
+	return buf.Bytes()
+}
+
+func Test_fetch_from_shared_cache(t *testing.T) {
+	defer workspace(map[string]string{}, t)()
+
+	ioutil.WriteFile("trait.zip", archive(map[string]string{"x-master/Dockerfile": "FROM debian:jessie\n"}, t), 0644)
+	hash, _ := digest("trait.zip")
+	shared := cache.New("shared")
+	shared.Store("trait.zip", hash)
+
+	origin := &use.Origin{Host: "github.com", Vendor: "a", Name: "x", Version: "master", Uri: "http://doget.invalid/x.zip", Prefix: "*/"}
+	fetcher := &Fetcher{UseCache: true, Shared: shared, Progress: progress}
+	fetched, err := fetcher.Fetch(origin, storage(config.Vendordir, origin), hash)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	assertEqual(hash, fetched.Archive, t)
+	content, _ := ioutil.ReadFile(filepath.Join(fetched.Path, "Dockerfile"))
+	assertEqual("FROM debian:jessie\n", string(content), t)
+
+	_, err = os.Stat(shared.Path(hash))
+	assertEqual(nil, err, t)
+}
+
+func Test_download_error_does_not_reveal_credentials(t *testing.T) {
+	defer workspace(map[string]string{}, t)()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	uri := strings.Replace(server.URL, "http://", "http://user:secret@", 1) + "/x.zip"
+	credentials := auth.New(map[string]*config.Credential{"127.0.0.1": &config.Credential{Token: "token"}}, nil)
+	_, _, err := download(uri, "x.zip", nil, authenticated(credentials, t), nil)
+	if err == nil {
+		t.Error("Expected an error, have none")
+		return
+	}
+	if strings.Contains(err.Error(), "secret") || strings.Contains(err.Error(), "token") {
+		t.Errorf("Error reveals credentials: %s", err.Error())
+	}
+	assertEqual(fmt.Sprintf("Could not download %q, response 403 Forbidden", strings.Replace(uri, "secret", "xxxxx", 1)), err.Error(), t)
+}
+
+func Test_fetch_revalidates_branches(t *testing.T) {
+	defer workspace(map[string]string{}, t)()
+
+	requests := make([]string, 0)
+	content := archive(map[string]string{"x-master/Dockerfile": "FROM debian:jessie\n"}, t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Header.Get("If-None-Match"))
+		if `"v1"` == r.Header.Get("If-None-Match") {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	origin := &use.Origin{Host: "github.com", Vendor: "a", Name: "x", Version: "master", Uri: server.URL + "/x.zip", Prefix: "*/"}
+	for _, from := range []string{fmt.Sprintf("downloaded %.2fkB", float64(len(content))/1024), "revalidated"} {
+		fetcher := &Fetcher{UseCache: true, Client: anonymous(t), Revalidate: 0}
+		fetched, err := fetcher.Fetch(origin, storage(config.Vendordir, origin), "")
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		assertEqual(from, fetched.From, t)
+	}
+	assertEqual([]string{"", `"v1"`}, requests, t)
+
+	metadata, _ := ReadMetadata(storage(config.Vendordir, origin) + ".meta")
+	assertEqual(`"v1"`, metadata.ETag, t)
+	assertEqual(server.URL+"/x.zip", metadata.Resolved, t)
+}
+
+func Test_transform_fetches_traits_sharing_an_archive_once(t *testing.T) {
+	content := archive(map[string]string{
+		"traits-1.0.0/php/Dockerfile":    "FROM debian:jessie\nRUN echo php\n",
+		"traits-1.0.0/common/Dockerfile": "FROM debian:jessie\nRUN echo common\n",
+	}, t)
+	requests := 0
+	var mutex sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests++
+		mutex.Unlock()
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	repositories := map[string]map[string]string{"h.example": map[string]string{"url": server.URL + "/{{.Vendor}}/{{.Name}}/{{.Version}}.zip"}}
+	for i := 0; i < 10; i++ {
+		requests = 0
+		func() {
+			defer workspace(map[string]string{
+				"Dockerfile.in": "FROM debian:jessie\nUSE h.example/acme/traits/php:v1.0.0\nUSE h.example/acme/traits/common:v1.0.0\n",
+			}, t)()
+
+			var buf bytes.Buffer
+			transformation := Transformation{Input: "Dockerfile.in", Output: &buf, UseCache: true, Workers: 4}
+			if err := transformation.Run(dockerfile.NewParser().Extend("USE", use.New(repositories).Extension)); err != nil {
+				t.Fatal(err.Error())
+			}
+			assertEqual(
+				"FROM debian:jessie\n\n# Included from h.example/acme/traits/php:v1.0.0\nRUN echo php\n\n# Included from h.example/acme/traits/common:v1.0.0\nRUN echo common\n\n",
+				buf.String(),
+				t,
+			)
+			assertEqual(1, requests, t)
+		}()
+	}
+}
+
+func Test_transform_pins_archive_of_cached_trait(t *testing.T) {
+	content := archive(map[string]string{"traits-1.0.0/php/Dockerfile": "FROM debian:jessie\nRUN echo php\n"}, t)
+	server := serve(map[string]string{"/acme/traits/v1.0.0.zip": string(content)})
+	defer server.Close()
+
+	hash := sha256.Sum256(content)
+	pinned := "sha256:" + hex.EncodeToString(hash[:])
+	defer workspace(map[string]string{
+		"Dockerfile.in": "FROM debian:jessie\nUSE h.example/acme/traits/php:v1.0.0 " + pinned + "\n",
+	}, t)()
+
+	repositories := map[string]map[string]string{"h.example": map[string]string{"url": server.URL + "/{{.Vendor}}/{{.Name}}/{{.Version}}.zip"}}
+	for _, from := range []string{"downloaded", "cached"} {
+		var buf bytes.Buffer
+		lock := NewLockfile("")
+		transformation := Transformation{Input: "Dockerfile.in", Output: &buf, UseCache: true, Lock: lock}
+		if err := transformation.Run(dockerfile.NewParser().Extend("USE", use.New(repositories).Extension)); err != nil {
+			t.Errorf("%s: %s", from, err.Error())
+			return
+		}
+
+		locked, _ := lock.Lookup("h.example/acme/traits/php:v1.0.0")
+		assertEqual(pinned, locked.Archive, t)
+	}
+}
+
+func Test_fetch_does_not_revalidate_tags(t *testing.T) {
+	defer workspace(map[string]string{}, t)()
+
+	requests := 0
+	content := archive(map[string]string{"x-1.0.0/Dockerfile": "FROM debian:jessie\n"}, t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	origin := &use.Origin{Host: "github.com", Vendor: "a", Name: "x", Version: "v1.0.0", Uri: server.URL + "/x.zip", Prefix: "*/"}
+	fetcher := &Fetcher{UseCache: true, Client: anonymous(t), Revalidate: 0}
+	for _, from := range []string{fmt.Sprintf("downloaded %.2fkB", float64(len(content))/1024), "cached"} {
+		fetched, err := fetcher.Fetch(origin, storage(config.Vendordir, origin), "")
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		assertEqual(from, fetched.From, t)
+	}
+	assertEqual(1, requests, t)
+}
+
+// flaky serves the given content, breaking off the first transfer half-way
+func flaky(content []byte) (*httptest.Server, *[]string) {
+	ranges := make([]string, 0)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		w.Header().Set("ETag", `"v1"`)
+		if 1 == len(ranges) {
+			w.Header().Set("Content-Length", fmt.Sprintf("%d", len(content)))
+			w.Write(content[0 : len(content)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, "x.zip", time.Time{}, bytes.NewReader(content))
+	})), &ranges
+}
+
+func Test_download_resumes_interrupted_transfer(t *testing.T) {
+	defer workspace(map[string]string{}, t)()
+
+	content := archive(map[string]string{"x-master/Dockerfile": "FROM debian:jessie\n"}, t)
+	server, ranges := flaky(content)
+	defer server.Close()
+
+	metadata, size, err := download(server.URL+"/x.zip", "x.zip", nil, anonymous(t), nil)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual(int64(len(content)), size, t)
+	assertEqual(`"v1"`, metadata.ETag, t)
+	assertEqual([]string{"", fmt.Sprintf("bytes=%d-", len(content)/2)}, *ranges, t)
+
+	downloaded, _ := ioutil.ReadFile("x.zip")
+	assertEqual(content, downloaded, t)
+	_, err = os.Stat("x.zip.part")
+	assertEqual(true, os.IsNotExist(err), t)
+}
+
+func Test_interrupted_download_leaves_no_file(t *testing.T) {
+	defer workspace(map[string]string{}, t)()
+
+	content := archive(map[string]string{"x-master/Dockerfile": "FROM debian:jessie\n"}, t)
+	server, _ := flaky(content)
+	defer server.Close()
+
+	c, _ := client.New(client.Options{Retries: 0}, nil)
+	if _, _, err := download(server.URL+"/x.zip", "x.zip", nil, c, nil); err == nil {
+		t.Error("Expected an error, have none")
+		return
+	}
+	_, err := os.Stat("x.zip")
+	assertEqual(true, os.IsNotExist(err), t)
+}
+
+func Test_download_exceeding_maximum_size(t *testing.T) {
+	defer workspace(map[string]string{}, t)()
+
+	for name, handler := range map[string]http.HandlerFunc{
+		"announced": func(w http.ResponseWriter, r *http.Request) {
+			w.Write(bytes.Repeat([]byte("x"), 2048))
+		},
+		"streamed": func(w http.ResponseWriter, r *http.Request) {
+			for i := 0; i < 4; i++ {
+				w.Write(bytes.Repeat([]byte("x"), 512))
+				w.(http.Flusher).Flush()
+			}
+		},
+	} {
+		server := httptest.NewServer(handler)
+		c, _ := client.New(client.Options{MaxSize: 1024}, nil)
+		_, _, err := download(server.URL+"/x.zip", "x.zip", nil, c, nil)
+		server.Close()
+
+		if err == nil {
+			t.Errorf("%s: expected an error, have none", name)
+			continue
+		}
+		assertEqual(fmt.Sprintf("Could not download %q, exceeds maximum size of 1024 bytes", server.URL+"/x.zip"), err.Error(), t)
+		_, err = os.Stat("x.zip.part")
+		assertEqual(true, os.IsNotExist(err), t)
+	}
+}
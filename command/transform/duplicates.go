@@ -0,0 +1,51 @@
+package transform
+
+import (
+	"fmt"
+	"os"
+)
+
+// Policies for traits included more than once, e.g. when two traits both
+// use a common base trait
+const (
+	Dedupe = "dedupe"
+	Warn   = "warn"
+	Fail   = "error"
+)
+
+// Duplicates tracks included traits and applies the given policy
+type Duplicates struct {
+	Policy   string
+	included map[string]Chain
+}
+
+// NewDuplicates creates a new duplicates tracker with a given policy
+func NewDuplicates(policy string) (*Duplicates, error) {
+	switch policy {
+	case Dedupe, Warn, Fail:
+		return &Duplicates{Policy: policy, included: make(map[string]Chain)}, nil
+	default:
+		return nil, fmt.Errorf("Unknown duplicates policy %q, expected one of [%s, %s, %s]", policy, Dedupe, Warn, Fail)
+	}
+}
+
+// Seen records a trait and returns whether it was already included before
+func (d *Duplicates) Seen(origin string, chain Chain) (bool, error) {
+	first, ok := d.included[origin]
+	if !ok {
+		d.included[origin] = chain
+		return false, nil
+	}
+
+	switch d.Policy {
+	case Warn:
+		fmt.Fprintf(os.Stderr, " ---> WARNING %s already included from %s, skipping\n", origin, first.String())
+		return true, nil
+
+	case Fail:
+		return true, fmt.Errorf("Duplicate include %s, already included from %s", origin, first.String())
+
+	default:
+		return true, nil
+	}
+}
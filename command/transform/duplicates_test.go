@@ -0,0 +1,50 @@
+package transform
+
+import (
+	"testing"
+)
+
+func Test_unknown_policy(t *testing.T) {
+	_, err := NewDuplicates("ignore")
+	if err == nil {
+		t.Error("Expected an error, have none")
+		return
+	}
+	assertEqual("Unknown duplicates policy \"ignore\", expected one of [dedupe, warn, error]", err.Error(), t)
+}
+
+func Test_first_include_not_seen(t *testing.T) {
+	for _, policy := range []string{Dedupe, Warn, Fail} {
+		duplicates, _ := NewDuplicates(policy)
+		seen, err := duplicates.Seen("github.com/c/base:master", Chain{})
+		assertEqual(false, seen, t)
+		assertEqual(nil, err, t)
+	}
+}
+
+func Test_dedupe_policy(t *testing.T) {
+	duplicates, _ := NewDuplicates(Dedupe)
+	duplicates.Seen("github.com/c/base:master", Chain{})
+	seen, err := duplicates.Seen("github.com/c/base:master", Chain{})
+	assertEqual(true, seen, t)
+	assertEqual(nil, err, t)
+}
+
+func Test_warn_policy(t *testing.T) {
+	duplicates, _ := NewDuplicates(Warn)
+	duplicates.Seen("github.com/c/base:master", Chain{})
+	seen, err := duplicates.Seen("github.com/c/base:master", Chain{})
+	assertEqual(true, seen, t)
+	assertEqual(nil, err, t)
+}
+
+func Test_error_policy(t *testing.T) {
+	duplicates, _ := NewDuplicates(Fail)
+	duplicates.Seen("github.com/c/base:master", Chain{{Name: "Dockerfile.in", Line: 2}})
+	_, err := duplicates.Seen("github.com/c/base:master", Chain{})
+	if err == nil {
+		t.Error("Expected an error, have none")
+		return
+	}
+	assertEqual("Duplicate include github.com/c/base:master, already included from Dockerfile.in:2", err.Error(), t)
+}
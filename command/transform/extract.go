@@ -0,0 +1,253 @@
+package transform
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/tueftler/doget/use"
+)
+
+// extract unpacks an archive in the given format, detecting it if empty or auto,
+// into the destination directory, stripping the given prefix from all paths inside it
+func extract(src, dest, format, prefix string) error {
+	if use.Auto == format || "" == format {
+		detected, err := detect(src)
+		if err != nil {
+			return err
+		}
+		format = detected
+	}
+
+	switch format {
+	case use.Zip:
+		return unzip(src, dest, prefix, "")
+
+	case use.TarGz:
+		return untar(src, dest, prefix, "", func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) })
+
+	case use.TarBz2:
+		return untar(src, dest, prefix, "", func(r io.Reader) (io.Reader, error) { return bzip2.NewReader(r), nil })
+
+	default:
+		return fmt.Errorf("Unknown archive format %q", format)
+	}
+}
+
+// detect determines an archive's format by the magic bytes at its beginning
+func detect(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	magic := make([]byte, 4)
+	n, _ := io.ReadFull(f, magic)
+	magic = magic[0:n]
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")), bytes.HasPrefix(magic, []byte("PK\x05\x06")):
+		return use.Zip, nil
+	case bytes.HasPrefix(magic, []byte("\x1f\x8b")):
+		return use.TarGz, nil
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		return use.TarBz2, nil
+	default:
+		return "", fmt.Errorf("Cannot detect archive format of %s, magic bytes %q", file, magic)
+	}
+}
+
+// strip removes a prefix from a path inside an archive. Prefixes consist of
+// directories and may contain wildcards, e.g. "*/" removes the top-level
+// directory. Paths not matching the prefix are returned unchanged.
+func strip(name, prefix string) string {
+	if "" == prefix {
+		return name
+	}
+
+	patterns := strings.Split(strings.TrimSuffix(prefix, "/"), "/")
+	segments := strings.SplitN(name, "/", len(patterns)+1)
+	if len(segments) <= len(patterns) {
+		return name
+	}
+
+	for i, pattern := range patterns {
+		if ok, _ := path.Match(pattern, segments[i]); !ok {
+			return name
+		}
+	}
+	return segments[len(patterns)]
+}
+
+// limits caps the number of entries extracted from an archive and their total uncompressed size
+type limits struct {
+	files int
+	size  int64
+}
+
+var maxima = limits{files: 65536, size: 1 << 30}
+
+var drive = regexp.MustCompile(`^[a-zA-Z]:`)
+
+// guard validates the entries extracted from an archive, rejecting those with paths or
+// link targets outside the destination directory as well as archives exceeding the limits.
+// If a root is given, entries must additionally lie inside this directory.
+type guard struct {
+	archive string
+	dest    string
+	root    string
+	limits  limits
+	files   int
+	size    int64
+}
+
+func newGuard(archive, dest, root string) *guard {
+	return &guard{archive: archive, dest: dest, root: root, limits: maxima}
+}
+
+func (g *guard) reject(name, reason string, args ...interface{}) error {
+	return fmt.Errorf("Rejected entry %q in %s: %s", name, g.archive, fmt.Sprintf(reason, args...))
+}
+
+// relative returns the path of an entry relative to the destination directory
+func (g *guard) relative(name, prefix string) (string, error) {
+	normalized := strings.Replace(name, "\\", "/", -1)
+	if strings.HasPrefix(normalized, "/") || drive.MatchString(normalized) {
+		return "", g.reject(name, "absolute paths are not allowed")
+	}
+
+	relative := path.Clean(strip(normalized, prefix))
+	if leaves(path.Clean(normalized)) || leaves(relative) {
+		return "", g.reject(name, "path leaves the destination directory")
+	} else if "" != g.root && relative != g.root && !strings.HasPrefix(relative, g.root+"/") {
+		return "", g.reject(name, "path lies outside %s", g.root)
+	}
+	return relative, nil
+}
+
+func leaves(relative string) bool {
+	return ".." == relative || strings.HasPrefix(relative, "../")
+}
+
+// path returns the path to extract a given entry to
+func (g *guard) path(name, prefix string) (string, error) {
+	g.files++
+	if g.files > g.limits.files {
+		return "", g.reject(name, "archive contains more than %d entries", g.limits.files)
+	}
+
+	relative, err := g.relative(name, prefix)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(g.dest, filepath.FromSlash(relative)), nil
+}
+
+// link verifies a symbolic link at the given location points inside the destination directory
+func (g *guard) link(name, location, target string) error {
+	normalized := strings.Replace(target, "\\", "/", -1)
+	if strings.HasPrefix(normalized, "/") || drive.MatchString(normalized) {
+		return g.reject(name, "symbolic link to absolute path %s", target)
+	}
+
+	relative, err := filepath.Rel(g.dest, filepath.Join(filepath.Dir(location), filepath.FromSlash(normalized)))
+	if err != nil || ".." == relative || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return g.reject(name, "symbolic link to %s leaves the destination directory", target)
+	}
+	return nil
+}
+
+// copy copies an entry's contents, enforcing the limit on the total uncompressed size
+func (g *guard) copy(name string, w io.Writer, r io.Reader) error {
+	n, err := io.Copy(w, io.LimitReader(r, g.limits.size-g.size+1))
+	g.size += n
+	if g.size > g.limits.size {
+		return g.reject(name, "archive exceeds %d bytes uncompressed", g.limits.size)
+	}
+	return err
+}
+
+// permissions returns the permissions to extract a file with. Only whether the file is
+// executable is taken from the archive, special bits such as setuid are never honored.
+func permissions(mode os.FileMode) os.FileMode {
+	if mode&0111 != 0 {
+		return 0755
+	}
+	return 0644
+}
+
+// untar extracts a tar archive. Symbolic and hard links are not extracted, but rejected if
+// their targets lie outside the destination directory; other special files are ignored.
+// If a root is given, entries outside of it are rejected.
+func untar(src, dest, prefix, root string, decompress func(io.Reader) (io.Reader, error)) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r, err := decompress(f)
+	if err != nil {
+		return err
+	}
+
+	os.MkdirAll(dest, 0755)
+
+	tr := tar.NewReader(r)
+	g := newGuard(src, dest, root)
+
+	// Closure to address file descriptors issue with all the deferred .Close() methods
+	write := func(name, path string, mode os.FileMode) error {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, permissions(mode))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		return g.copy(name, f, tr)
+	}
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		path, err := g.path(header.Name, prefix)
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			os.MkdirAll(path, 0755)
+
+		case tar.TypeReg, tar.TypeRegA:
+			os.MkdirAll(filepath.Dir(path), 0755)
+			if err := write(header.Name, path, header.FileInfo().Mode()); err != nil {
+				return err
+			}
+
+		case tar.TypeSymlink:
+			if err := g.link(header.Name, path, header.Linkname); err != nil {
+				return err
+			}
+
+		case tar.TypeLink:
+			if _, err := g.relative(header.Linkname, prefix); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package transform
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tueftler/doget/use"
+)
+
+// tarball creates a gzipped tar archive with the given files
+func tarball(files map[string]string, t *testing.T) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	w := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := w.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err.Error())
+		}
+		w.Write([]byte(content))
+	}
+	w.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+// A bzip2-compressed tar archive containing "x-v1.0.0/Dockerfile"
+const bzipped = "\x42\x5a\x68\x39\x31\x41\x59\x26\x53\x59\xcf\x14\x4b\xf2\x00\x00\x82\x5f\x80\xca\x90\xc0\x03\xfd\x10\x05\x02\x90\x00\x7f\x3d\x9f\x40\x08\x08\x20\x00\x74\x21\x35\x1a\x68\x08\xd3\x00\x02\x34\xda\x3c\x50\x4a\x50\x00\x06\x80\x00\x00\x0f\xb0\x84\x5d\x04\x07\x19\x41\x04\x22\xe1\x4e\x8a\x81\xe7\x10\x10\x58\x1f\x5c\xab\xd7\xda\x24\x58\x45\x0d\x90\x08\x44\x42\x0d\xad\x09\xa1\xf2\x1f\x56\xb9\xf7\x2e\x70\xe9\xa1\x7f\x4b\x0e\xc3\x6b\xcc\xf5\xe9\x11\xe9\x22\x1b\x3d\xb9\x8a\x4a\xab\x68\x88\x80\x78\x2e\xe4\x8a\x70\xa1\x21\x9e\x28\x97\xe4"
+
+func Test_strip(t *testing.T) {
+	for _, fixture := range []struct{ name, prefix, expect string }{
+		{"x-master/Dockerfile", "*/", "Dockerfile"},
+		{"x-master/", "*/", ""},
+		{"x-master/sub/Dockerfile", "x-master/", "sub/Dockerfile"},
+		{"other/Dockerfile", "x-master/", "other/Dockerfile"},
+		{"a/b/Dockerfile", "*/*/", "Dockerfile"},
+		{"Dockerfile", "", "Dockerfile"},
+	} {
+		assertEqual(fixture.expect, strip(fixture.name, fixture.prefix), t)
+	}
+}
+
+func Test_detect(t *testing.T) {
+	defer workspace(map[string]string{}, t)()
+
+	for format, content := range map[string][]byte{
+		use.Zip:    archive(map[string]string{"x-master/Dockerfile": "FROM debian:jessie\n"}, t),
+		use.TarGz:  tarball(map[string]string{"x-master/Dockerfile": "FROM debian:jessie\n"}, t),
+		use.TarBz2: []byte(bzipped),
+	} {
+		ioutil.WriteFile("archive", content, 0644)
+		detected, err := detect("archive")
+		if err != nil {
+			t.Error(err.Error())
+		}
+		assertEqual(format, detected, t)
+	}
+}
+
+func Test_detect_unknown_format(t *testing.T) {
+	defer workspace(map[string]string{"archive": "<html>"}, t)()
+
+	_, err := detect("archive")
+	assertEqual("Cannot detect archive format of archive, magic bytes \"<htm\"", err.Error(), t)
+}
+
+func Test_extract(t *testing.T) {
+	defer workspace(map[string]string{}, t)()
+
+	for format, content := range map[string][]byte{
+		use.Zip:    archive(map[string]string{"x-v1.0.0/Dockerfile": "FROM debian:jessie\n"}, t),
+		use.TarGz:  tarball(map[string]string{"x-v1.0.0/Dockerfile": "FROM debian:jessie\n"}, t),
+		use.TarBz2: []byte(bzipped),
+	} {
+		ioutil.WriteFile("archive", content, 0644)
+		for _, given := range []string{format, use.Auto} {
+			target := filepath.Join("out", format, given)
+			if err := extract("archive", target, given, "x-v1.0.0/"); err != nil {
+				t.Error(err.Error())
+				continue
+			}
+
+			content, _ := ioutil.ReadFile(filepath.Join(target, "Dockerfile"))
+			assertEqual("FROM debian:jessie\n", string(content), t)
+		}
+	}
+}
+
+// malicious creates a zip archive and a gzipped tar archive containing a Dockerfile
+// and the given entry, a symbolic link if a target is given
+func malicious(name, target string, t *testing.T) map[string][]byte {
+	var z, tgz bytes.Buffer
+
+	zw := zip.NewWriter(&z)
+	f, _ := zw.Create("x-v1.0.0/Dockerfile")
+	f.Write([]byte("FROM debian:jessie\n"))
+	header := &zip.FileHeader{Name: name}
+	content := "pwned"
+	if "" != target {
+		header.SetMode(os.ModeSymlink | 0777)
+		content = target
+	}
+	f, _ = zw.CreateHeader(header)
+	f.Write([]byte(content))
+	zw.Close()
+
+	gz := gzip.NewWriter(&tgz)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: "x-v1.0.0/Dockerfile", Mode: 0644, Size: 19, Typeflag: tar.TypeReg})
+	tw.Write([]byte("FROM debian:jessie\n"))
+	if "" != target {
+		tw.WriteHeader(&tar.Header{Name: name, Linkname: target, Mode: 0777, Typeflag: tar.TypeSymlink})
+	} else {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gz.Close()
+
+	return map[string][]byte{use.Zip: z.Bytes(), use.TarGz: tgz.Bytes()}
+}
+
+func Test_extract_rejects_entries(t *testing.T) {
+	defer workspace(map[string]string{}, t)()
+
+	for _, fixture := range []struct{ name, target, reason string }{
+		{"x-v1.0.0/../../evil", "", "path leaves the destination directory"},
+		{"../evil", "", "path leaves the destination directory"},
+		{"x-v1.0.0\\..\\..\\evil", "", "path leaves the destination directory"},
+		{"/tmp/evil", "", "absolute paths are not allowed"},
+		{"C:/evil", "", "absolute paths are not allowed"},
+		{"x-v1.0.0/link", "../../evil", "symbolic link to ../../evil leaves the destination directory"},
+		{"x-v1.0.0/link", "/etc/passwd", "symbolic link to absolute path /etc/passwd"},
+	} {
+		for format, content := range malicious(fixture.name, fixture.target, t) {
+			ioutil.WriteFile("archive", content, 0644)
+			err := extract("archive", filepath.Join("out", "x"), format, "*/")
+			if err == nil {
+				t.Errorf("%s %s: expected an error, have none", format, fixture.name)
+				continue
+			}
+			assertEqual(fmt.Sprintf("Rejected entry %q in archive: %s", fixture.name, fixture.reason), err.Error(), t)
+		}
+	}
+
+	_, err := os.Stat("evil")
+	assertEqual(true, os.IsNotExist(err), t)
+}
+
+func Test_extract_skips_symlinks_inside_destination(t *testing.T) {
+	defer workspace(map[string]string{}, t)()
+
+	for format, content := range malicious("x-v1.0.0/link", "Dockerfile", t) {
+		ioutil.WriteFile("archive", content, 0644)
+		target := filepath.Join("out", format)
+		if err := extract("archive", target, format, "*/"); err != nil {
+			t.Error(err.Error())
+			continue
+		}
+
+		_, err := os.Lstat(filepath.Join(target, "link"))
+		assertEqual(true, os.IsNotExist(err), t)
+	}
+}
+
+func Test_extract_ignores_special_permissions(t *testing.T) {
+	defer workspace(map[string]string{}, t)()
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, mode := range map[string]os.FileMode{"x-v1.0.0/run": os.ModeSetuid | 0777, "x-v1.0.0/Dockerfile": 0666} {
+		header := &zip.FileHeader{Name: name}
+		header.SetMode(mode)
+		f, _ := w.CreateHeader(header)
+		f.Write([]byte("FROM debian:jessie\n"))
+	}
+	w.Close()
+	ioutil.WriteFile("archive", buf.Bytes(), 0644)
+
+	if err := extract("archive", "out", use.Zip, "*/"); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	for name, executable := range map[string]bool{"run": true, "Dockerfile": false} {
+		stat, _ := os.Stat(filepath.Join("out", name))
+		assertEqual(os.FileMode(0), stat.Mode()&(os.ModeSetuid|0002), t)
+		assertEqual(executable, stat.Mode()&0100 != 0, t)
+	}
+}
+
+func Test_extract_limits(t *testing.T) {
+	defer workspace(map[string]string{}, t)()
+	defer func(original limits) { maxima = original }(maxima)
+
+	files := map[string]string{"x-v1.0.0/a": "1234", "x-v1.0.0/b": "1234", "x-v1.0.0/c": "1234"}
+	for _, fixture := range []struct {
+		limits limits
+		reason string
+	}{
+		{limits{files: 2, size: 1024}, "archive contains more than 2 entries"},
+		{limits{files: 10, size: 10}, "archive exceeds 10 bytes uncompressed"},
+	} {
+		maxima = fixture.limits
+		for format, content := range map[string][]byte{use.Zip: archive(files, t), use.TarGz: tarball(files, t)} {
+			ioutil.WriteFile("archive", content, 0644)
+			err := extract("archive", filepath.Join("out", format), format, "*/")
+			if err == nil {
+				t.Errorf("%s: expected an error, have none", format)
+				continue
+			}
+			assertEqual(true, strings.HasSuffix(err.Error(), ": "+fixture.reason), t)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package transform
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/tueftler/doget/auth"
+	"github.com/tueftler/doget/client"
+)
+
+// git runs a git command inside a given directory with additional environment
+// variables, returning its trimmed output
+func git(dir string, env []string, args ...string) (string, error) {
+	var stderr bytes.Buffer
+
+	c := exec.Command("git", args...)
+	c.Dir = dir
+	c.Env = append(os.Environ(), env...)
+	c.Stderr = &stderr
+	out, err := c.Output()
+	if err != nil {
+		redacted := make([]string, len(args))
+		for i, arg := range args {
+			redacted[i] = auth.Redact(arg)
+		}
+		return "", fmt.Errorf("git %s failed: %s", strings.Join(redacted, " "), strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// environment passes the client's settings for a given repository to git via its environment:
+// headers including credentials, so they don't show up in the process list, proxy and CA bundle
+func environment(uri string, client *client.Client) ([]string, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil || "" == parsed.Host {
+		return nil, nil
+	}
+
+	headers, err := client.Credentials.Headers(parsed.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := make([]string, 0)
+	for name := range headers {
+		settings = append(settings, "http.extraHeader", name+": "+headers.Get(name))
+	}
+
+	if proxy, err := client.Proxy(parsed); err != nil {
+		return nil, err
+	} else if nil != proxy {
+		settings = append(settings, "http.proxy", proxy.String())
+	} else {
+		settings = append(settings, "http.proxy", "")
+	}
+
+	if "" != client.Options.CABundle {
+		settings = append(settings, "http.sslCAInfo", client.Options.CABundle)
+	}
+
+	env := make([]string, 0, len(settings)+1)
+	for i := 0; i < len(settings); i += 2 {
+		env = append(env, fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", i/2, settings[i]), fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", i/2, settings[i+1]))
+	}
+	return append(env, fmt.Sprintf("GIT_CONFIG_COUNT=%d", len(settings)/2)), nil
+}
+
+// clone checks out a given version - a branch, tag or commit SHA - of a git repository
+// into the target directory and returns the commit SHA. Only the requested commit is
+// fetched if the remote supports this. The whole tree is checked out, as the target is
+// shared by all traits inside the repository at this version.
+func clone(uri, version, target string, client *client.Client) (string, error) {
+	env, err := environment(uri, client)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.RemoveAll(target); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return "", err
+	}
+
+	if _, err := git(target, nil, "init", "-q"); err != nil {
+		return "", err
+	}
+	if _, err := git(target, nil, "remote", "add", "--", "origin", uri); err != nil {
+		return "", err
+	}
+
+	// Servers may refuse shallow fetches of commit SHAs, fall back to fetching everything.
+	// The version is separated from options so it can never be mistaken for one.
+	if _, err := git(target, env, "fetch", "-q", "--depth", "1", "--end-of-options", "origin", version); err == nil {
+		_, err = git(target, nil, "checkout", "-q", "FETCH_HEAD")
+		if err != nil {
+			return "", err
+		}
+	} else if _, err := git(target, env, "fetch", "-q", "--tags", "origin"); err != nil {
+		return "", err
+	} else if _, err := git(target, nil, "checkout", "-q", "--end-of-options", version, "--"); err != nil {
+		return "", err
+	}
+
+	revision, err := git(target, nil, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	return revision, os.RemoveAll(filepath.Join(target, ".git"))
+}
+
+// head returns the commit SHA a given branch points to, or an empty string if there is no such branch
+func head(uri, branch string, client *client.Client) (string, error) {
+	env, err := environment(uri, client)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := git("", env, "ls-remote", "--heads", "--end-of-options", uri, branch)
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range strings.Split(out, "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && "refs/heads/"+branch == fields[1] {
+			return fields[0], nil
+		}
+	}
+	return "", nil
+}
+
+// refs lists the names of all tags in a git repository
+func refs(uri string, client *client.Client) ([]string, error) {
+	env, err := environment(uri, client)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := git("", env, "ls-remote", "--tags", "--refs", "--end-of-options", uri)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0)
+	for _, line := range strings.Split(out, "\n") {
+		if pos := strings.Index(line, "refs/tags/"); pos != -1 {
+			names = append(names, line[pos+len("refs/tags/"):len(line)])
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,230 @@
+package transform
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/tueftler/doget/auth"
+	"github.com/tueftler/doget/client"
+	"github.com/tueftler/doget/config"
+	"github.com/tueftler/doget/dockerfile"
+	"github.com/tueftler/doget/use"
+)
+
+// repository creates a bare git repository "acme/traits.git" inside a temporary
+// directory with two commits on master, the first of which is tagged v1.0.0, and
+// returns the directory and the commits' SHAs
+func repository(t *testing.T) (string, []string) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	dir := tempDir(t)
+	bare := filepath.Join(dir, "acme", "traits.git")
+	work := filepath.Join(dir, "work")
+	os.MkdirAll(bare, 0755)
+	os.MkdirAll(filepath.Join(work, "php"), 0755)
+	os.MkdirAll(filepath.Join(work, "common"), 0755)
+
+	run := func(dir string, args ...string) string {
+		out, err := git(dir, nil, append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)...)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return out
+	}
+
+	run(bare, "init", "-q", "--bare")
+	run(work, "init", "-q")
+	ioutil.WriteFile(filepath.Join(work, "php", "Dockerfile"), []byte("FROM debian:jessie\nRUN echo 1\n"), 0644)
+	ioutil.WriteFile(filepath.Join(work, "common", "Dockerfile"), []byte("FROM debian:jessie\nRUN echo common\n"), 0644)
+	ioutil.WriteFile(filepath.Join(work, "README.md"), []byte("Traits\n"), 0644)
+	run(work, "add", ".")
+	run(work, "commit", "-q", "-m", "First")
+	run(work, "tag", "v1.0.0")
+	first := run(work, "rev-parse", "HEAD")
+
+	ioutil.WriteFile(filepath.Join(work, "php", "Dockerfile"), []byte("FROM debian:jessie\nRUN echo 2\n"), 0644)
+	run(work, "commit", "-q", "-a", "-m", "Second")
+	second := run(work, "rev-parse", "HEAD")
+	run(work, "push", "-q", "file://"+filepath.ToSlash(bare), "HEAD:refs/heads/master", "--tags")
+
+	return dir, []string{first, second}
+}
+
+func Test_clone_versions(t *testing.T) {
+	dir, commits := repository(t)
+	defer os.RemoveAll(dir)
+	uri := "file://" + filepath.ToSlash(dir) + "/acme/traits.git"
+
+	for version, expected := range map[string]string{"master": commits[1], "v1.0.0": commits[0], commits[0]: commits[0]} {
+		target := tempDir(t)
+		revision, err := clone(uri, version, target, anonymous(t))
+		if err != nil {
+			t.Error(err.Error())
+		} else {
+			assertEqual(expected, revision, t)
+		}
+		os.RemoveAll(target)
+	}
+}
+
+func Test_clone_checks_out_whole_tree(t *testing.T) {
+	dir, _ := repository(t)
+	defer os.RemoveAll(dir)
+	uri := "file://" + filepath.ToSlash(dir) + "/acme/traits.git"
+
+	target := tempDir(t)
+	defer os.RemoveAll(target)
+
+	if _, err := clone(uri, "master", target, anonymous(t)); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	content, _ := ioutil.ReadFile(filepath.Join(target, "php", "Dockerfile"))
+	assertEqual("FROM debian:jessie\nRUN echo 2\n", string(content), t)
+
+	_, err := os.Stat(filepath.Join(target, "README.md"))
+	assertEqual(nil, err, t)
+	_, err = os.Stat(filepath.Join(target, ".git"))
+	assertEqual(true, os.IsNotExist(err), t)
+}
+
+func Test_clone_does_not_treat_version_as_option(t *testing.T) {
+	dir, _ := repository(t)
+	defer os.RemoveAll(dir)
+	uri := "file://" + filepath.ToSlash(dir) + "/acme/traits.git"
+	pwned := filepath.Join(dir, "pwned")
+
+	target := tempDir(t)
+	defer os.RemoveAll(target)
+	if _, err := clone(uri, "--upload-pack=touch "+pwned+"; git-upload-pack", target, anonymous(t)); err == nil {
+		t.Error("Expected an error, have none")
+	}
+	if _, err := head(uri, "--upload-pack=touch "+pwned+"; git-upload-pack", anonymous(t)); err != nil {
+		t.Error(err.Error())
+	}
+
+	_, err := os.Stat(pwned)
+	assertEqual(true, os.IsNotExist(err), t)
+}
+
+func Test_refs(t *testing.T) {
+	dir, _ := repository(t)
+	defer os.RemoveAll(dir)
+	uri := "file://" + filepath.ToSlash(dir) + "/acme/traits.git"
+
+	names, err := refs(uri, anonymous(t))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual([]string{"v1.0.0"}, names, t)
+}
+
+func Test_head(t *testing.T) {
+	dir, commits := repository(t)
+	defer os.RemoveAll(dir)
+	uri := "file://" + filepath.ToSlash(dir) + "/acme/traits.git"
+
+	for branch, expected := range map[string]string{"master": commits[1], "develop": ""} {
+		revision, err := head(uri, branch, anonymous(t))
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		assertEqual(expected, revision, t)
+	}
+}
+
+func Test_fetch_revalidates_git_branches(t *testing.T) {
+	dir, commits := repository(t)
+	defer os.RemoveAll(dir)
+	defer workspace(map[string]string{}, t)()
+
+	origin := &use.Origin{Host: "git.example.com", Vendor: "acme", Name: "traits", Version: "master", Dir: "php", Type: use.Git, Uri: "file://" + filepath.ToSlash(dir) + "/acme/traits.git"}
+	for _, from := range []string{"cloned", "revalidated"} {
+		fetcher := &Fetcher{UseCache: true, Client: anonymous(t), Revalidate: 0}
+		fetched, err := fetcher.Fetch(origin, storage(config.Vendordir, origin), "")
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		assertEqual(from, fetched.From, t)
+		assertEqual(commits[1], fetched.Revision, t)
+	}
+}
+
+func Test_transform_clones_from_git_repository(t *testing.T) {
+	dir, commits := repository(t)
+	defer os.RemoveAll(dir)
+	defer workspace(map[string]string{
+		"Dockerfile.in": "FROM debian:jessie\nUSE git.example.com/acme/traits/php:^1.0\n",
+	}, t)()
+
+	repositories := map[string]map[string]string{
+		"git.example.com": map[string]string{"type": "git", "url": "file://" + filepath.ToSlash(dir) + "/{{.Vendor}}/{{.Name}}.git"},
+	}
+	parser := dockerfile.NewParser().Extend("USE", use.New(repositories).Extension)
+	lock := NewLockfile(config.Lockfile)
+
+	var buf bytes.Buffer
+	transformation := Transformation{Input: "Dockerfile.in", Output: &buf, UseCache: true, Lock: lock}
+	if err := transformation.Run(parser); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual("FROM debian:jessie\n\n# Included from git.example.com/acme/traits/php:v1.0.0\nRUN echo 1\n\n", buf.String(), t)
+
+	locked, _ := lock.Lookup("git.example.com/acme/traits/php:^1.0")
+	assertEqual(commits[0], locked.Revision, t)
+}
+
+func Test_transform_includes_two_traits_from_same_git_repository(t *testing.T) {
+	dir, _ := repository(t)
+	defer os.RemoveAll(dir)
+	defer workspace(map[string]string{
+		"Dockerfile.in": "FROM debian:jessie\nUSE git.example.com/acme/traits/php\nUSE git.example.com/acme/traits/common\n",
+	}, t)()
+
+	repositories := map[string]map[string]string{
+		"git.example.com": map[string]string{"type": "git", "url": "file://" + filepath.ToSlash(dir) + "/{{.Vendor}}/{{.Name}}.git"},
+	}
+	parser := dockerfile.NewParser().Extend("USE", use.New(repositories).Extension)
+
+	var buf bytes.Buffer
+	transformation := Transformation{Input: "Dockerfile.in", Output: &buf, UseCache: true, Workers: 1}
+	if err := transformation.Run(parser); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual(
+		"FROM debian:jessie\n\n# Included from git.example.com/acme/traits/php:master\nRUN echo 2\n\n# Included from git.example.com/acme/traits/common:master\nRUN echo common\n\n",
+		buf.String(),
+		t,
+	)
+}
+
+func Test_environment_passes_settings_to_git(t *testing.T) {
+	options := client.Defaults()
+	options.CABundle = "testdata/ca.pem"
+	options.Proxies = map[string]string{"git.example.com": "http://proxy.example.com:3128"}
+	c := &client.Client{Options: options, Credentials: auth.New(map[string]*config.Credential{"git.example.com": &config.Credential{Token: "secret"}}, nil)}
+
+	env, err := environment("https://git.example.com/acme/traits.git", c)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual([]string{
+		"GIT_CONFIG_KEY_0=http.extraHeader", "GIT_CONFIG_VALUE_0=Authorization: Bearer secret",
+		"GIT_CONFIG_KEY_1=http.proxy", "GIT_CONFIG_VALUE_1=http://proxy.example.com:3128",
+		"GIT_CONFIG_KEY_2=http.sslCAInfo", "GIT_CONFIG_VALUE_2=testdata/ca.pem",
+		"GIT_CONFIG_COUNT=3",
+	}, env, t)
+}
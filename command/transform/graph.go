@@ -0,0 +1,178 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/tueftler/doget/dockerfile"
+	"github.com/tueftler/doget/semver"
+	"github.com/tueftler/doget/use"
+)
+
+// Node represents a file inside the dependency graph: either the input or a trait at a specific version.
+// For traits, From describes how they were fetched and Uri where from.
+type Node struct {
+	Name     string
+	Origin   *use.Origin
+	Path     string
+	File     *dockerfile.Dockerfile
+	Revision string
+	Archive  string
+	Digest   string
+	From     string
+	Uri      string
+	Err      error
+	Requires map[*use.Statement]*Edge
+}
+
+// Edge represents a USE statement and the node it requires. If a replacement
+// was applied, Replaces holds the originally requested reference.
+type Edge struct {
+	Origin   *use.Origin
+	Replaces string
+	Locked   *Lock
+	Node     *Node
+	Err      error
+}
+
+// Requirement represents a USE statement requiring a trait
+type Requirement struct {
+	Node       *Node
+	Constraint string
+	Chain      Chain
+}
+
+// Graph holds all traits reachable from the input, at all versions required
+type Graph struct {
+	Root         *Node
+	Nodes        map[string]*Node
+	Requirements map[string][]*Requirement
+	Selected     map[string]*Node
+	mutex        sync.Mutex
+}
+
+// ConflictError is raised when no version of a trait satisfies all requirements
+type ConflictError struct {
+	Path         string
+	Requirements []*Requirement
+}
+
+// NewNode creates a new node
+func NewNode(name string, origin *use.Origin, path string, file *dockerfile.Dockerfile) *Node {
+	return &Node{Name: name, Origin: origin, Path: path, File: file, Requires: make(map[*use.Statement]*Edge)}
+}
+
+// NewGraph creates a new graph starting at the given root
+func NewGraph(root *Node) *Graph {
+	return &Graph{
+		Root:         root,
+		Nodes:        make(map[string]*Node),
+		Requirements: make(map[string][]*Requirement),
+		Selected:     make(map[string]*Node),
+	}
+}
+
+// Claim returns the node for a given resolved origin, creating it if necessary.
+// The second return value indicates whether the node was created, in which case
+// the caller is responsible for fetching it.
+func (g *Graph) Claim(origin *use.Origin) (*Node, bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if node, ok := g.Nodes[origin.String()]; ok {
+		return node, false
+	}
+
+	node := NewNode(origin.String(), origin, "", nil)
+	g.Nodes[node.Name] = node
+	return node, true
+}
+
+// Require records a requirement
+func (g *Graph) Require(node *Node, constraint string, chain Chain) {
+	path := node.Origin.Path()
+	g.Requirements[path] = append(g.Requirements[path], &Requirement{Node: node, Constraint: constraint, Chain: chain})
+}
+
+// Select picks one version per trait using minimal version selection: every
+// requirement is treated as a minimum, and the highest of these minimums is
+// selected. The selection must satisfy all version constraints; versions not
+// comparable as semantic versions, e.g. branches, must be identical.
+func (g *Graph) Select() error {
+	paths := make([]string, 0, len(g.Requirements))
+	for path := range g.Requirements {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	conflicts := make([]string, 0)
+	for _, path := range paths {
+		requirements := g.Requirements[path]
+		if selected, ok := selection(requirements); ok {
+			g.Selected[path] = selected
+		} else {
+			conflicts = append(conflicts, (&ConflictError{Path: path, Requirements: requirements}).Error())
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return fmt.Errorf("%s", strings.Join(conflicts, "\n"))
+	}
+	return nil
+}
+
+// Selection returns the node selected for a given origin
+func (g *Graph) Selection(origin *use.Origin) *Node {
+	return g.Selected[origin.Path()]
+}
+
+// Error lists all requirements for the conflicting trait
+func (e *ConflictError) Error() string {
+	required := make([]string, len(e.Requirements))
+	for i, requirement := range e.Requirements {
+		version := requirement.Node.Origin.Version
+		if "" != requirement.Constraint {
+			version = requirement.Constraint + " (" + version + ")"
+		}
+		required[i] = version + " required by " + requirement.Chain.String()
+	}
+	return fmt.Sprintf("Cannot select a version of %s: %s", e.Path, strings.Join(required, ", "))
+}
+
+func selection(requirements []*Requirement) (*Node, bool) {
+	selected := requirements[0].Node
+	for _, requirement := range requirements[1:len(requirements)] {
+		if requirement.Node == selected {
+			continue
+		}
+
+		a, err := semver.Parse(selected.Origin.Version)
+		if err != nil {
+			return nil, false
+		}
+		b, err := semver.Parse(requirement.Node.Origin.Version)
+		if err != nil {
+			return nil, false
+		}
+
+		if b.Compare(a) > 0 {
+			selected = requirement.Node
+		}
+	}
+
+	version, err := semver.Parse(selected.Origin.Version)
+	for _, requirement := range requirements {
+		if "" == requirement.Constraint {
+			continue
+		}
+
+		constraint, _ := semver.ParseConstraint(requirement.Constraint)
+		if err != nil || !constraint.Matches(version) {
+			return nil, false
+		}
+	}
+
+	return selected, true
+}
@@ -0,0 +1,59 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/tueftler/doget/use"
+)
+
+func requirement(version, constraint string, line int) *Requirement {
+	origin := &use.Origin{Host: "github.com", Vendor: "c", Name: "base", Version: version, Constraint: constraint}
+	return &Requirement{
+		Node:       NewNode(origin.String(), origin, "", nil),
+		Constraint: constraint,
+		Chain:      Chain{{Name: "Dockerfile.in", Line: line}},
+	}
+}
+
+func selected(requirements ...*Requirement) (string, error) {
+	graph := NewGraph(nil)
+	graph.Requirements["github.com/c/base"] = requirements
+	if err := graph.Select(); err != nil {
+		return "", err
+	}
+	return graph.Selected["github.com/c/base"].Origin.Version, nil
+}
+
+func Test_select_single_requirement(t *testing.T) {
+	version, err := selected(requirement("master", "", 1))
+	assertEqual(nil, err, t)
+	assertEqual("master", version, t)
+}
+
+func Test_select_highest_minimum(t *testing.T) {
+	version, err := selected(requirement("v1.1.0", "", 1), requirement("v1.3.0", "", 2), requirement("v1.2.0", "", 3))
+	assertEqual(nil, err, t)
+	assertEqual("v1.3.0", version, t)
+}
+
+func Test_select_satisfying_constraints(t *testing.T) {
+	version, err := selected(requirement("v1.4.2", "~1.4.0", 1), requirement("v1.2.0", "", 2))
+	assertEqual(nil, err, t)
+	assertEqual("v1.4.2", version, t)
+}
+
+func Test_select_violating_constraint(t *testing.T) {
+	_, err := selected(requirement("v1.4.2", "~1.4.0", 1), requirement("v1.5.0", "", 2))
+	if err == nil {
+		t.Error("Expected an error, have none")
+		return
+	}
+	assertEqual("Cannot select a version of github.com/c/base: ~1.4.0 (v1.4.2) required by Dockerfile.in:1, v1.5.0 required by Dockerfile.in:2", err.Error(), t)
+}
+
+func Test_select_incomparable_versions(t *testing.T) {
+	_, err := selected(requirement("master", "", 1), requirement("v1.0.0", "", 2))
+	if err == nil {
+		t.Error("Expected an error, have none")
+	}
+}
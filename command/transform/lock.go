@@ -0,0 +1,188 @@
+package transform
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sync"
+
+	"github.com/tueftler/doget/use"
+	"gopkg.in/yaml.v2"
+)
+
+// Lock records the exact revision and content hashes of a resolved trait
+type Lock struct {
+	Uri        string `yaml:"uri"`
+	Replace    string `yaml:"replace,omitempty"`
+	Version    string `yaml:"version,omitempty"`
+	Revision   string `yaml:"revision"`
+	Archive    string `yaml:"archive,omitempty"`
+	Dockerfile string `yaml:"dockerfile"`
+}
+
+// Vendored records a remote file referenced by an ADD instruction and stored in the vendor directory
+type Vendored struct {
+	Path   string `yaml:"path"`
+	Digest string `yaml:"digest"`
+}
+
+// Lockfile holds the locks for all traits, keyed by their origin, and for vendored files, keyed by their URL
+type Lockfile struct {
+	Source  string               `yaml:"-"`
+	Traits  map[string]*Lock     `yaml:"traits"`
+	Sources map[string]*Vendored `yaml:"sources,omitempty"`
+	changed bool
+	mutex   sync.Mutex
+}
+
+const lockHeader = "# Generated by DoGet, do not edit.\n# Regenerate using `doget transform -update-lock`\n"
+
+var commit = regexp.MustCompile("^[0-9a-f]{40}$")
+
+// NewLockfile creates an empty lockfile which will be written to the given source
+func NewLockfile(source string) *Lockfile {
+	return &Lockfile{Source: source, Traits: make(map[string]*Lock), Sources: make(map[string]*Vendored)}
+}
+
+// OpenLockfile reads the given lockfile. If it does not exist, an empty one is returned
+func OpenLockfile(source string) (*Lockfile, error) {
+	lockfile := NewLockfile(source)
+
+	input, err := ioutil.ReadFile(source)
+	if os.IsNotExist(err) {
+		return lockfile, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(input, lockfile); err != nil {
+		return nil, fmt.Errorf("Cannot parse lockfile %s: %s", source, err.Error())
+	}
+
+	if lockfile.Traits == nil {
+		lockfile.Traits = make(map[string]*Lock)
+	}
+	if lockfile.Sources == nil {
+		lockfile.Sources = make(map[string]*Vendored)
+	}
+	return lockfile, nil
+}
+
+// Lookup returns the lock for a given origin
+func (l *Lockfile) Lookup(origin string) (*Lock, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	lock, ok := l.Traits[origin]
+	return lock, ok
+}
+
+// Record adds a lock for a given origin
+func (l *Lockfile) Record(origin string, lock *Lock) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.Traits[origin] = lock
+	l.changed = true
+}
+
+// Vendored returns the lock for a given vendored file
+func (l *Lockfile) Vendored(uri string) (*Vendored, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	vendored, ok := l.Sources[uri]
+	return vendored, ok
+}
+
+// RecordVendored adds a lock for a given vendored file
+func (l *Lockfile) RecordVendored(uri string, vendored *Vendored) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.Sources[uri] = vendored
+	l.changed = true
+}
+
+// Save writes the lockfile if it was changed
+func (l *Lockfile) Save() error {
+	if !l.changed || "" == l.Source {
+		return nil
+	}
+
+	output, err := yaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+
+	if err := atomically(l.Source, append([]byte(lockHeader), output...)); err != nil {
+		return err
+	}
+
+	l.changed = false
+	return nil
+}
+
+// Verify checks a given digest against the locked one
+func (l *Lock) Verify(origin, kind, expected, actual string) error {
+	if "" == expected || "" == actual || expected == actual {
+		return nil
+	}
+
+	return fmt.Errorf("Hash mismatch for %s of %s: locked %s, have %s", kind, origin, expected, actual)
+}
+
+// integrity verifies a trait against the digest given in its USE reference,
+// which may either be that of the downloaded archive or the included Dockerfile.
+// If the trait was served from cache, its locked archive hash is consulted.
+func integrity(origin *use.Origin, archive, dockerfile string, locked *Lock) error {
+	if "" == origin.Digest || origin.Digest == archive || origin.Digest == dockerfile {
+		return nil
+	}
+
+	if "" == archive && nil != locked && origin.Digest == locked.Archive && dockerfile == locked.Dockerfile {
+		return nil
+	}
+
+	have := dockerfile + " (Dockerfile)"
+	if "" != archive {
+		have = archive + " (archive), " + have
+	}
+	return fmt.Errorf("Integrity check failed for %s: expected %s, have %s", origin.String(), origin.Digest, have)
+}
+
+// digest calculates the SHA256 hash of a given file's contents
+func digest(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// revision returns the commit SHA stored in the archive's comment (as done by
+// GitHub), using the given version if the archive does not contain one
+func revision(file, version string) string {
+	r, err := zip.OpenReader(file)
+	if err != nil {
+		return version
+	}
+	defer r.Close()
+
+	if commit.MatchString(r.Comment) {
+		return r.Comment
+	}
+	return version
+}
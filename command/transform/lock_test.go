@@ -0,0 +1,115 @@
+package transform
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/tueftler/doget/use"
+)
+
+func assertEqual(expect, actual interface{}, t *testing.T) {
+	if !reflect.DeepEqual(expect, actual) {
+		t.Errorf("Items not equal:\nexpected %q\nhave     %q\n", expect, actual)
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "doget")
+	if err != nil {
+		t.Fatalf("Cannot create temporary directory: %s", err.Error())
+	}
+	return dir
+}
+
+func Test_open_nonexistant_lockfile(t *testing.T) {
+	lockfile, err := OpenLockfile("doesNotExist.lock")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual(0, len(lockfile.Traits), t)
+}
+
+func Test_lockfile_roundtrip(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	lock := &Lock{Uri: "https://example.com/trait.zip", Revision: "v1.0.0", Archive: "sha256:aa", Dockerfile: "sha256:bb"}
+	lockfile := NewLockfile(filepath.Join(dir, "doget.lock"))
+	lockfile.Record("github.com/thekid/trait:v1.0.0", lock)
+	if err := lockfile.Save(); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	read, err := OpenLockfile(lockfile.Source)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	locked, ok := read.Lookup("github.com/thekid/trait:v1.0.0")
+	assertEqual(true, ok, t)
+	assertEqual(lock, locked, t)
+}
+
+func Test_unchanged_lockfile_is_not_written(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	lockfile := NewLockfile(filepath.Join(dir, "doget.lock"))
+	if err := lockfile.Save(); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	_, err := os.Stat(lockfile.Source)
+	assertEqual(true, os.IsNotExist(err), t)
+}
+
+func Test_verify_matching_hash(t *testing.T) {
+	assertEqual(nil, (&Lock{}).Verify("github.com/thekid/trait", "archive", "sha256:aa", "sha256:aa"), t)
+}
+
+func Test_verify_without_hash(t *testing.T) {
+	assertEqual(nil, (&Lock{}).Verify("github.com/thekid/trait", "archive", "sha256:aa", ""), t)
+}
+
+func Test_verify_mismatching_hash(t *testing.T) {
+	err := (&Lock{}).Verify("github.com/thekid/trait", "archive", "sha256:aa", "sha256:bb")
+	if err == nil {
+		t.Error("Expected an error, have none")
+		return
+	}
+	assertEqual("Hash mismatch for archive of github.com/thekid/trait: locked sha256:aa, have sha256:bb", err.Error(), t)
+}
+
+func Test_integrity_without_digest(t *testing.T) {
+	assertEqual(nil, integrity(&use.Origin{}, "sha256:aa", "sha256:bb", nil), t)
+}
+
+func Test_integrity_of_archive(t *testing.T) {
+	assertEqual(nil, integrity(&use.Origin{Digest: "sha256:aa"}, "sha256:aa", "sha256:bb", nil), t)
+}
+
+func Test_integrity_of_dockerfile(t *testing.T) {
+	assertEqual(nil, integrity(&use.Origin{Digest: "sha256:bb"}, "sha256:aa", "sha256:bb", nil), t)
+}
+
+func Test_integrity_of_cached_archive_via_lock(t *testing.T) {
+	locked := &Lock{Archive: "sha256:aa", Dockerfile: "sha256:bb"}
+	assertEqual(nil, integrity(&use.Origin{Digest: "sha256:aa"}, "", "sha256:bb", locked), t)
+}
+
+func Test_integrity_mismatch(t *testing.T) {
+	origin := &use.Origin{Host: "github.com", Vendor: "thekid", Name: "trait", Version: "v1.0.0", Digest: "sha256:cc"}
+	err := integrity(origin, "sha256:aa", "sha256:bb", nil)
+	if err == nil {
+		t.Error("Expected an error, have none")
+		return
+	}
+	assertEqual("Integrity check failed for github.com/thekid/trait:v1.0.0: expected sha256:cc, have sha256:aa (archive), sha256:bb (Dockerfile)", err.Error(), t)
+}
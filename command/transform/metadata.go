@@ -0,0 +1,81 @@
+package transform
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tueftler/doget/semver"
+	"gopkg.in/yaml.v2"
+)
+
+// Metadata records how a trait was fetched, allowing to revalidate it later on
+type Metadata struct {
+	Uri          string    `yaml:"uri"`
+	Resolved     string    `yaml:"resolved,omitempty"`
+	ETag         string    `yaml:"etag,omitempty"`
+	LastModified string    `yaml:"last-modified,omitempty"`
+	Revision     string    `yaml:"revision,omitempty"`
+	Archive      string    `yaml:"archive,omitempty"`
+	Fetched      time.Time `yaml:"fetched"`
+}
+
+// ReadMetadata reads the metadata stored in the given file. If it does not exist, nil is returned
+func ReadMetadata(file string) (*Metadata, error) {
+	input, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	metadata := &Metadata{}
+	if err := yaml.Unmarshal(input, metadata); err != nil {
+		return nil, fmt.Errorf("Cannot parse metadata %s: %s", file, err.Error())
+	}
+	return metadata, nil
+}
+
+// Write stores the metadata in the given file
+func (m *Metadata) Write(file string) error {
+	output, err := yaml.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, output, 0644)
+}
+
+// validator returns the value to be used in an If-Range header: the ETag if it is
+// a strong one, the Last-Modified date otherwise
+func (m *Metadata) validator() string {
+	if "" != m.ETag && !strings.HasPrefix(m.ETag, "W/") {
+		return m.ETag
+	}
+	return m.LastModified
+}
+
+// Stale returns whether a trait fetched at the given version needs to be revalidated.
+// Tags and commit SHAs are immutable and never need to be unless a different commit was
+// fetched before, branches are once the given interval has passed since they were fetched.
+// Traits without metadata, e.g. those from a checked-in vendor archive, are kept as-is.
+func (m *Metadata) Stale(version string, interval time.Duration, now time.Time) bool {
+	if nil == m {
+		return false
+	} else if commit.MatchString(version) {
+		return commit.MatchString(m.Revision) && version != m.Revision
+	} else if immutable(version) {
+		return false
+	}
+	return !now.Before(m.Fetched.Add(interval))
+}
+
+// immutable returns whether a version references a tag or a commit
+func immutable(version string) bool {
+	if commit.MatchString(version) {
+		return true
+	}
+	_, err := semver.Parse(version)
+	return err == nil
+}
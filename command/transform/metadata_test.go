@@ -0,0 +1,68 @@
+package transform
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var fetched = time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+func Test_metadata_roundtrip(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	metadata := &Metadata{Uri: "https://example.com/x.zip", ETag: `"abc"`, LastModified: "Sun, 18 Oct 2026 12:00:00 GMT", Fetched: fetched}
+	if err := metadata.Write(filepath.Join(dir, "x.meta")); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	read, err := ReadMetadata(filepath.Join(dir, "x.meta"))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual(metadata, read, t)
+}
+
+func Test_nonexistant_metadata(t *testing.T) {
+	metadata, err := ReadMetadata("doesNotExist.meta")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if nil != metadata {
+		t.Errorf("Expected nil, have %+v", metadata)
+	}
+}
+
+func Test_tags_are_never_stale(t *testing.T) {
+	metadata := &Metadata{Fetched: fetched}
+	for _, version := range []string{"v1.0.0", "1.2", "v2.0.0-rc1"} {
+		assertEqual(false, metadata.Stale(version, time.Hour, fetched.Add(24*time.Hour)), t)
+	}
+}
+
+func Test_commits_are_never_stale(t *testing.T) {
+	sha := "0123456789abcdef0123456789abcdef01234567"
+	metadata := &Metadata{Revision: sha, Fetched: fetched}
+	assertEqual(false, metadata.Stale(sha, time.Hour, fetched.Add(24*time.Hour)), t)
+}
+
+func Test_commit_differing_from_fetched_one_is_stale(t *testing.T) {
+	metadata := &Metadata{Revision: "0123456789abcdef0123456789abcdef01234567", Fetched: fetched}
+	assertEqual(true, metadata.Stale("fedcba9876543210fedcba9876543210fedcba98", time.Hour, fetched), t)
+}
+
+func Test_branches_are_stale_after_interval(t *testing.T) {
+	metadata := &Metadata{Revision: "master", Fetched: fetched}
+	assertEqual(false, metadata.Stale("master", time.Hour, fetched.Add(59*time.Minute)), t)
+	assertEqual(true, metadata.Stale("master", time.Hour, fetched.Add(time.Hour)), t)
+}
+
+func Test_missing_metadata_is_not_stale(t *testing.T) {
+	var metadata *Metadata
+	assertEqual(false, metadata.Stale("master", time.Hour, fetched), t)
+}
@@ -0,0 +1,79 @@
+package transform
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/tueftler/doget/semver"
+	"github.com/tueftler/doget/use"
+)
+
+// MissingError is raised in offline mode when a trait is available neither
+// in the vendor directory nor in the shared cache
+type MissingError struct {
+	Origin string
+}
+
+// Error names the missing trait
+func (e *MissingError) Error() string {
+	return fmt.Sprintf("Trait %s is not available offline", e.Origin)
+}
+
+// available resolves an origin's version constraint to the highest matching
+// version already present in the given vendor directory
+func available(context *use.Context, vendor string, origin *use.Origin) error {
+	constraint, err := semver.ParseConstraint(origin.Constraint)
+	if err != nil {
+		return err
+	}
+
+	infos, _ := ioutil.ReadDir(filepath.Join(vendor, origin.Host, origin.Vendor, origin.Name))
+	versions := make([]string, 0, len(infos))
+	for _, info := range infos {
+		if info.IsDir() {
+			versions = append(versions, info.Name())
+		}
+	}
+
+	version, ok := constraint.Highest(versions)
+	if !ok {
+		return &MissingError{Origin: origin.String()}
+	}
+	return context.Resolve(origin, version)
+}
+
+// missing collects all traits missing in offline mode into a single error
+func missing(graph *Graph) error {
+	nodes := []*Node{graph.Root}
+	for _, node := range graph.Nodes {
+		nodes = append(nodes, node)
+	}
+
+	seen := make(map[string]bool)
+	for _, node := range nodes {
+		errors := []error{node.Err}
+		for _, edge := range node.Requires {
+			errors = append(errors, edge.Err)
+		}
+
+		for _, err := range errors {
+			if e, ok := err.(*MissingError); ok {
+				seen[e.Origin] = true
+			}
+		}
+	}
+
+	if len(seen) == 0 {
+		return nil
+	}
+
+	list := make([]string, 0, len(seen))
+	for origin := range seen {
+		list = append(list, origin)
+	}
+	sort.Strings(list)
+	return fmt.Errorf("Cannot transform offline, the following traits are missing:\n  - %s", strings.Join(list, "\n  - "))
+}
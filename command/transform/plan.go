@@ -0,0 +1,121 @@
+package transform
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Actions reported for traits in a plan
+const (
+	Fetch  = "fetch"
+	Cached = "cached"
+	Local  = "local"
+)
+
+// Plan records what a transformation would do, without writing any output
+type Plan struct {
+	Traits []*Planned
+	Checks []*Check
+}
+
+// Planned is a trait along with whether it would be fetched and where from
+type Planned struct {
+	Origin   string
+	Action   string
+	Uri      string
+	Selected bool
+}
+
+// Check is a trait's FROM image checked against the images provided when including it
+type Check struct {
+	Origin string
+	Image  string
+	Ok     bool
+}
+
+// action returns whether a trait was fetched, given how Fetch obtained it
+func action(node *Node) string {
+	switch {
+	case "" != node.Origin.Local:
+		return Local
+	case strings.HasPrefix(node.From, "downloaded"), "cloned" == node.From:
+		return Fetch
+	default:
+		return Cached
+	}
+}
+
+// collect records all traits inside the given graph, sorted by name
+func (p *Plan) collect(graph *Graph) {
+	names := make([]string, 0, len(graph.Nodes))
+	for name := range graph.Nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	p.Traits = make([]*Planned, 0, len(names))
+	for _, name := range names {
+		node := graph.Nodes[name]
+		if nil == node.File {
+			continue
+		}
+		p.Traits = append(p.Traits, &Planned{
+			Origin:   name,
+			Action:   action(node),
+			Uri:      node.Uri,
+			Selected: graph.Selection(node.Origin) == node,
+		})
+	}
+}
+
+// check records a PROVIDES check
+func (p *Plan) check(origin, image string, ok bool) {
+	p.Checks = append(p.Checks, &Check{Origin: origin, Image: image, Ok: ok})
+}
+
+// failed returns an error listing all failed PROVIDES checks, or nil if all of them passed
+func (p *Plan) failed() error {
+	failed := make([]string, 0)
+	for _, check := range p.Checks {
+		if !check.Ok {
+			failed = append(failed, check.Origin+" requires "+check.Image)
+		}
+	}
+	if 0 == len(failed) {
+		return nil
+	}
+	return fmt.Errorf("%d of %d PROVIDES checks failed: %s", len(failed), len(p.Checks), strings.Join(failed, ", "))
+}
+
+// Print writes the plan to the given output
+func (p *Plan) Print(out io.Writer) {
+	fetch := 0
+	for _, trait := range p.Traits {
+		if Fetch == trait.Action {
+			fetch++
+		}
+	}
+
+	fmt.Fprintf(out, "Traits (%d, %d to fetch):\n", len(p.Traits), fetch)
+	for _, trait := range p.Traits {
+		line := fmt.Sprintf("  %-7s%s", trait.Action, trait.Origin)
+		if "" != trait.Uri {
+			line += " <- " + trait.Uri
+		}
+		if !trait.Selected {
+			line += " (not selected)"
+		}
+		fmt.Fprintln(out, line)
+	}
+
+	fmt.Fprintf(out, "Provides checks (%d):\n", len(p.Checks))
+	for _, check := range p.Checks {
+		result := "ok"
+		if !check.Ok {
+			result = "failed"
+		}
+		fmt.Fprintf(out, "  %-7s%s requires %s\n", result, check.Origin, check.Image)
+	}
+}
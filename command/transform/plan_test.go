@@ -0,0 +1,110 @@
+package transform
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/tueftler/doget/config"
+	"github.com/tueftler/doget/dockerfile"
+	"github.com/tueftler/doget/provides"
+	"github.com/tueftler/doget/use"
+)
+
+func plan(vendor string, t *testing.T) (*Plan, error) {
+	parser := dockerfile.NewParser().
+		Extend("USE", use.New(config.Default().Repositories).Extension).
+		Extend("PROVIDES", provides.Extension)
+
+	plan := &Plan{}
+	transformation := Transformation{Input: "Dockerfile.in", Output: ioutil.Discard, Vendor: vendor, UseCache: true, Lock: NewLockfile(config.Lockfile), Plan: plan}
+	err := transformation.Run(parser)
+	return plan, err
+}
+
+func Test_plan_reports_cached_and_fetched_traits(t *testing.T) {
+	server := serve(map[string]string{"/php/Dockerfile": "FROM debian:jessie\nUSE github.com/a/x\nRUN echo php\n"})
+	defer server.Close()
+	defer workspace(map[string]string{
+		"Dockerfile.in":                 "FROM debian:jessie\nUSE " + server.URL + "/php/Dockerfile\n",
+		cached("github.com/a/x/master"): "FROM debian:jessie\nRUN echo x\n",
+	}, t)()
+
+	storage, _ := NewStorage(NoneStorage, config.Vendordir)
+	scratch := tempDir(t)
+	defer os.RemoveAll(scratch)
+	vendor, err := storage.Scratch(scratch)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	plan, err := plan(vendor, t)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual(2, len(plan.Traits), t)
+	assertEqual(&Planned{Origin: server.URL + "/php/Dockerfile", Action: Fetch, Uri: server.URL + "/php/Dockerfile", Selected: true}, plan.Traits[1], t)
+	assertEqual(Cached, plan.Traits[0].Action, t)
+	assertEqual([]*Check{
+		{Origin: server.URL + "/php/Dockerfile", Image: "debian:jessie", Ok: true},
+		{Origin: "github.com/a/x:master", Image: "debian:jessie", Ok: true},
+	}, plan.Checks, t)
+
+	// Neither the vendor directory nor the lockfile are touched
+	entries, _ := ioutil.ReadDir(config.Vendordir)
+	assertEqual(1, len(entries), t)
+	_, err = os.Stat(config.Lockfile)
+	assertEqual(true, os.IsNotExist(err), t)
+}
+
+func Test_plan_records_all_provides_checks(t *testing.T) {
+	defer workspace(map[string]string{
+		"Dockerfile.in":                 "FROM alpine:3.5\nUSE github.com/a/x\nUSE github.com/a/y\nUSE github.com/a/z\n",
+		cached("github.com/a/x/master"): "FROM debian:jessie\nRUN echo x\n",
+		cached("github.com/a/y/master"): "FROM alpine:3.5\nRUN echo y\n",
+		cached("github.com/a/z/master"): "FROM ubuntu:16.04\nRUN echo z\n",
+	}, t)()
+
+	plan, err := plan(config.Vendordir, t)
+	if err == nil {
+		t.Error("Expected an error, have none")
+		return
+	}
+	assertEqual("2 of 3 PROVIDES checks failed: github.com/a/x:master requires debian:jessie, github.com/a/z:master requires ubuntu:16.04", err.Error(), t)
+	assertEqual([]*Check{
+		{Origin: "github.com/a/x:master", Image: "debian:jessie", Ok: false},
+		{Origin: "github.com/a/y:master", Image: "alpine:3.5", Ok: true},
+		{Origin: "github.com/a/z:master", Image: "ubuntu:16.04", Ok: false},
+	}, plan.Checks, t)
+}
+
+func Test_plan_print(t *testing.T) {
+	plan := &Plan{
+		Traits: []*Planned{
+			{Origin: "github.com/a/x:v1.0.0", Action: Fetch, Uri: "https://github.com/a/x/archive/v1.0.0.zip", Selected: true},
+			{Origin: "github.com/a/y:master", Action: Cached, Uri: "https://github.com/a/y/archive/master.zip", Selected: false},
+			{Origin: "./traits/php", Action: Local, Uri: "./traits/php", Selected: true},
+		},
+		Checks: []*Check{
+			{Origin: "github.com/a/x:v1.0.0", Image: "debian:jessie", Ok: true},
+			{Origin: "./traits/php", Image: "alpine:3.5", Ok: false},
+		},
+	}
+
+	var buf bytes.Buffer
+	plan.Print(&buf)
+	assertEqual(
+		"Traits (3, 1 to fetch):\n"+
+			"  fetch  github.com/a/x:v1.0.0 <- https://github.com/a/x/archive/v1.0.0.zip\n"+
+			"  cached github.com/a/y:master <- https://github.com/a/y/archive/master.zip (not selected)\n"+
+			"  local  ./traits/php <- ./traits/php\n"+
+			"Provides checks (2):\n"+
+			"  ok     github.com/a/x:v1.0.0 requires debian:jessie\n"+
+			"  failed ./traits/php requires alpine:3.5\n",
+		buf.String(),
+		t,
+	)
+}
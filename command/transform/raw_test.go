@@ -0,0 +1,82 @@
+package transform
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tueftler/doget/config"
+	"github.com/tueftler/doget/dockerfile"
+	"github.com/tueftler/doget/use"
+)
+
+// serve starts a server returning the given Dockerfiles by their paths
+func serve(files map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if content, ok := files[r.URL.Path]; ok {
+			w.Write([]byte(content))
+		} else {
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func transformRaw(repositories map[string]map[string]string) (string, error) {
+	parser := dockerfile.NewParser().Extend("USE", use.New(repositories).Extension)
+
+	var buf bytes.Buffer
+	transformation := Transformation{Input: "Dockerfile.in", Output: &buf, UseCache: true}
+	err := transformation.Run(parser)
+	return buf.String(), err
+}
+
+func Test_transform_includes_dockerfile_by_url(t *testing.T) {
+	server := serve(map[string]string{"/php/Dockerfile": "FROM debian:jessie\nRUN echo php\n"})
+	defer server.Close()
+	defer workspace(map[string]string{"Dockerfile.in": "FROM debian:jessie\nUSE " + server.URL + "/php/Dockerfile\n"}, t)()
+
+	out, err := transformRaw(config.Default().Repositories)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual("FROM debian:jessie\n\n# Included from "+server.URL+"/php/Dockerfile\nRUN echo php\n\n", out, t)
+
+	// Served from vendor directory from now on
+	server.Close()
+	out, err = transformRaw(config.Default().Repositories)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual("FROM debian:jessie\n\n# Included from "+server.URL+"/php/Dockerfile\nRUN echo php\n\n", out, t)
+}
+
+func Test_transform_includes_dockerfile_from_raw_repository(t *testing.T) {
+	server := serve(map[string]string{"/acme/traits/v1.0.0/php/Dockerfile": "FROM debian:jessie\nRUN echo php\n"})
+	defer server.Close()
+	defer workspace(map[string]string{"Dockerfile.in": "FROM debian:jessie\nUSE raw.example.com/acme/traits/php:v1.0.0\n"}, t)()
+
+	out, err := transformRaw(map[string]map[string]string{
+		"raw.example.com": map[string]string{"type": "raw", "url": server.URL + "/{{.Vendor}}/{{.Name}}/{{.Version}}/{{.Dir}}/Dockerfile"},
+	})
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual("FROM debian:jessie\n\n# Included from raw.example.com/acme/traits/php:v1.0.0\nRUN echo php\n\n", out, t)
+}
+
+func Test_transform_refuses_copy_from_raw_trait(t *testing.T) {
+	server := serve(map[string]string{"/php/Dockerfile": "FROM debian:jessie\nCOPY php.ini /etc/php.ini\n"})
+	defer server.Close()
+	defer workspace(map[string]string{"Dockerfile.in": "FROM debian:jessie\nUSE " + server.URL + "/php/Dockerfile\n"}, t)()
+
+	_, err := transformRaw(config.Default().Repositories)
+	if err == nil {
+		t.Error("Expected an error, have none")
+		return
+	}
+	assertEqual("Dockerfile.in:2: Cannot COPY php.ini /etc/php.ini from "+server.URL+"/php/Dockerfile, only its Dockerfile is downloaded", err.Error(), t)
+}
@@ -0,0 +1,71 @@
+package transform
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/tueftler/doget/use"
+)
+
+// replace applies the replacement configured for a given origin, returning nil
+// if there is none. Keys may either reference a specific version, e.g.
+// "github.com/acme/traits/php:v1.0.0", a trait regardless of its version, e.g.
+// "github.com/acme/traits/php", or all traits inside a repository, e.g.
+// "github.com/acme/traits". Replacements are either local directories, which
+// are resolved relative to the current directory, or references to another
+// trait. If these don't specify a version, the one originally requested is used.
+func replace(context *use.Context, replacements map[string]string, origin *use.Origin) (*use.Origin, error) {
+	if "" != origin.Local || 0 == len(replacements) {
+		return nil, nil
+	}
+
+	// Find most specific match
+	rest := ""
+	target, ok := replacements[origin.String()]
+	if !ok {
+		segments := strings.Split(origin.Path(), "/")
+		for i := len(segments); i >= 3 && !ok; i-- {
+			target, ok = replacements[strings.Join(segments[0:i], "/")]
+			rest = strings.Join(segments[i:len(segments)], "/")
+		}
+		if !ok {
+			return nil, nil
+		}
+	}
+
+	if filepath.IsAbs(target) {
+		target = "file://" + filepath.ToSlash(target)
+	}
+
+	statement := &use.Statement{Context: context, Reference: target}
+	replaced, err := statement.Origin()
+	if err != nil {
+		return nil, fmt.Errorf("Malformed replacement for %s: %s", origin.String(), err.Error())
+	}
+	if replaced, err = replaced.Within(nil, "."); err != nil {
+		return nil, err
+	}
+
+	if "" != replaced.Local {
+		replaced.Local = filepath.Join(replaced.Local, filepath.FromSlash(rest))
+		return replaced, nil
+	}
+
+	// Inherit version unless given, e.g. "github.com/fork/traits" vs. "github.com/fork/traits:fix"
+	replaced.Dir = path.Join(replaced.Dir, rest)
+	if !strings.Contains(target[strings.LastIndex(target, "/")+1:len(target)], ":") {
+		replaced.Version = origin.Version
+		replaced.Constraint = origin.Constraint
+	}
+
+	if "" == replaced.Constraint {
+		if err := context.Resolve(replaced, replaced.Version); err != nil {
+			return nil, err
+		}
+	} else {
+		replaced.Uri = ""
+	}
+	return replaced, nil
+}
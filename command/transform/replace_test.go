@@ -0,0 +1,68 @@
+package transform
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/tueftler/doget/config"
+	"github.com/tueftler/doget/use"
+)
+
+func replaced(reference string, replacements map[string]string, t *testing.T) string {
+	context := use.New(config.Default().Repositories)
+	origin, err := (&use.Statement{Context: context, Reference: reference}).Origin()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	result, err := replace(context, replacements, origin)
+	if err != nil {
+		t.Fatal(err.Error())
+	} else if nil == result {
+		return ""
+	}
+	return result.String() + " " + result.Uri
+}
+
+func Test_replace_without_match(t *testing.T) {
+	assertEqual("", replaced("github.com/acme/traits/php", map[string]string{"github.com/acme/other": "./other"}, t), t)
+}
+
+func Test_replace_with_local_directory(t *testing.T) {
+	assertEqual("dev/php ", replaced("github.com/acme/traits/php:v1.0.0", map[string]string{"github.com/acme/traits/php": "./dev/php"}, t), t)
+}
+
+func Test_replace_with_absolute_directory(t *testing.T) {
+	dir, _ := filepath.Abs("dev")
+	assertEqual(filepath.ToSlash(dir)+" ", replaced("github.com/acme/traits/php", map[string]string{"github.com/acme/traits/php": dir}, t), t)
+}
+
+func Test_replace_repository_keeps_directory(t *testing.T) {
+	assertEqual("dev/traits/php ", replaced("github.com/acme/traits/php", map[string]string{"github.com/acme/traits": "./dev/traits"}, t), t)
+}
+
+func Test_replace_with_fork_inherits_version(t *testing.T) {
+	assertEqual(
+		"github.com/fork/traits/php:v1.0.0 https://github.com/fork/traits/archive/v1.0.0.zip",
+		replaced("github.com/acme/traits/php:v1.0.0", map[string]string{"github.com/acme/traits": "github.com/fork/traits"}, t),
+		t,
+	)
+}
+
+func Test_replace_with_fork_at_version(t *testing.T) {
+	assertEqual(
+		"github.com/fork/traits/php:fix https://github.com/fork/traits/archive/fix.zip",
+		replaced("github.com/acme/traits/php:v1.0.0", map[string]string{"github.com/acme/traits/php": "github.com/fork/traits/php:fix"}, t),
+		t,
+	)
+}
+
+func Test_replace_specific_version(t *testing.T) {
+	replacements := map[string]string{"github.com/acme/traits/php:v1.0.0": "./dev/php"}
+	assertEqual("dev/php ", replaced("github.com/acme/traits/php:v1.0.0", replacements, t), t)
+	assertEqual("", replaced("github.com/acme/traits/php:v2.0.0", replacements, t), t)
+}
+
+func Test_replace_keeps_constraint(t *testing.T) {
+	assertEqual("github.com/fork/traits/php:^1.0 ", replaced("github.com/acme/traits/php:^1.0", map[string]string{"github.com/acme/traits/php": "github.com/fork/traits/php"}, t), t)
+}
@@ -0,0 +1,99 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/tueftler/doget/auth"
+	"github.com/tueftler/doget/client"
+	"github.com/tueftler/doget/semver"
+	"github.com/tueftler/doget/use"
+)
+
+var next = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// tags lists the names of all tags at a given URI. Supports JSON arrays of
+// objects with a "name" key as returned by GitHub, and objects wrapping these
+// in a "values" key as returned by BitBucket. Pagination is followed via the
+// "Link" header or the "next" key, respectively.
+func tags(uri string, client *client.Client) ([]string, error) {
+	names := make([]string, 0)
+
+	for "" != uri {
+		resp, err := client.Get(uri, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != 200 {
+			resp.Body.Close()
+			return nil, fmt.Errorf("Could not list tags from %q, response %s", auth.Redact(uri), resp.Status)
+		}
+
+		var page struct {
+			Values []struct {
+				Name string `json:"name"`
+			} `json:"values"`
+			Next string `json:"next"`
+		}
+
+		// Wrap GitHub-style arrays so both formats decode into the same structure
+		var raw json.RawMessage
+		err = json.NewDecoder(resp.Body).Decode(&raw)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Could not list tags from %q: %s", auth.Redact(uri), err.Error())
+		}
+
+		if len(raw) > 0 && '[' == raw[0] {
+			raw = append(append([]byte(`{"values":`), raw...), '}')
+		}
+		if err := json.Unmarshal(raw, &page); err != nil {
+			return nil, fmt.Errorf("Could not list tags from %q: %s", auth.Redact(uri), err.Error())
+		}
+
+		for _, value := range page.Values {
+			names = append(names, value.Name)
+		}
+
+		uri = page.Next
+		if match := next.FindStringSubmatch(resp.Header.Get("Link")); match != nil {
+			uri = match[1]
+		}
+	}
+
+	return names, nil
+}
+
+// resolve resolves an origin's version constraint to the highest matching tag
+func resolve(context *use.Context, origin *use.Origin, client *client.Client) error {
+	constraint, err := semver.ParseConstraint(origin.Constraint)
+	if err != nil {
+		return err
+	}
+
+	uri, err := context.Tags(origin)
+	if err != nil {
+		return err
+	}
+
+	var list []string
+	if use.Git == origin.Type {
+		list, err = refs(uri, client)
+	} else {
+		list, err = tags(uri, client)
+	}
+	if err != nil {
+		return err
+	}
+
+	tag, ok := constraint.Highest(list)
+	if !ok {
+		return fmt.Errorf("None of the tags %q of %s match %s", list, origin.Path(), constraint)
+	}
+
+	fmt.Fprintf(os.Stderr, " ---> RESOLVE %s => %s\n", origin.String(), tag)
+	return context.Resolve(origin, tag)
+}
@@ -0,0 +1,112 @@
+package transform
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tueftler/doget/auth"
+	"github.com/tueftler/doget/config"
+	"github.com/tueftler/doget/use"
+)
+
+func Test_tags_from_array(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"name":"v1.0.0"},{"name":"v1.1.0"}]`)
+	}))
+	defer server.Close()
+
+	list, err := tags(server.URL, anonymous(t))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual([]string{"v1.0.0", "v1.1.0"}, list, t)
+}
+
+func Test_tags_following_link_header(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if "2" == r.URL.Query().Get("page") {
+			fmt.Fprint(w, `[{"name":"v1.1.0"}]`)
+		} else {
+			w.Header().Set("Link", fmt.Sprintf(`<%s/?page=2>; rel="next", <%s/?page=2>; rel="last"`, server.URL, server.URL))
+			fmt.Fprint(w, `[{"name":"v1.0.0"}]`)
+		}
+	}))
+	defer server.Close()
+
+	list, err := tags(server.URL, anonymous(t))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual([]string{"v1.0.0", "v1.1.0"}, list, t)
+}
+
+func Test_tags_following_next_key(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if "2" == r.URL.Query().Get("page") {
+			fmt.Fprint(w, `{"values":[{"name":"v1.1.0"}]}`)
+		} else {
+			fmt.Fprintf(w, `{"values":[{"name":"v1.0.0"}],"next":"%s/?page=2"}`, server.URL)
+		}
+	}))
+	defer server.Close()
+
+	list, err := tags(server.URL, anonymous(t))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual([]string{"v1.0.0", "v1.1.0"}, list, t)
+}
+
+func Test_tags_error(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	_, err := tags(server.URL, anonymous(t))
+	assertEqual(fmt.Sprintf("Could not list tags from %q, response 404 Not Found", server.URL), err.Error(), t)
+}
+
+func Test_resolve_highest_matching_tag(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"name":"v1.1.0"},{"name":"v1.2.0"},{"name":"v1.3.1"},{"name":"v2.0.0"}]`)
+	}))
+	defer server.Close()
+
+	context := use.New(map[string]map[string]string{"example.com": map[string]string{
+		"url":  "https://example.com/{{.Vendor}}/{{.Name}}/{{.Version}}.zip",
+		"tags": server.URL + "/{{.Vendor}}/{{.Name}}/tags",
+	}})
+	origin := &use.Origin{Host: "example.com", Vendor: "thekid", Name: "traits", Version: "^1.2", Constraint: "^1.2"}
+	if err := resolve(context, origin, anonymous(t)); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual("v1.3.1", origin.Version, t)
+	assertEqual("https://example.com/thekid/traits/v1.3.1.zip", origin.Uri, t)
+}
+
+func Test_tags_sends_credentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if "Bearer secret" != r.Header.Get("Authorization") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `[{"name":"v1.0.0"}]`)
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	list, err := tags(server.URL, authenticated(auth.New(map[string]*config.Credential{host: &config.Credential{Token: "secret"}}, nil), t))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual([]string{"v1.0.0"}, list, t)
+}
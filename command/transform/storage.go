@@ -0,0 +1,288 @@
+package transform
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Formats the vendor directory is stored in between runs: inside an archive next to
+// it, as a plain directory, e.g. to be checked in, or not at all
+const (
+	ZipStorage  = "zip"
+	TarStorage  = "tar"
+	DirStorage  = "dir"
+	NoneStorage = "none"
+)
+
+// epoch is used as modification time for all entries, the earliest date zip supports
+var epoch = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Storage restores and saves the vendor directory in a given format
+type Storage struct {
+	Format string
+	Dir    string
+}
+
+// entry is a file or directory to be stored, named relative to the vendor directory's parent.
+// If content is given, it is stored instead of the file's contents.
+type entry struct {
+	path    string
+	name    string
+	info    os.FileInfo
+	content []byte
+}
+
+// open returns a reader for the entry's contents along with their size
+func (e entry) open() (io.ReadCloser, int64, error) {
+	if nil != e.content {
+		return ioutil.NopCloser(bytes.NewReader(e.content)), int64(len(e.content)), nil
+	}
+
+	f, err := os.Open(e.path)
+	if err != nil {
+		return nil, -1, err
+	}
+	return f, e.info.Size(), nil
+}
+
+// sidecar returns the contents to store for a trait's metadata file without the time it was
+// fetched at, which changes each time it is revalidated. Returns nil for all other files.
+func sidecar(path string) ([]byte, error) {
+	if !strings.HasSuffix(path, ".meta") {
+		return nil, nil
+	} else if _, err := os.Stat(strings.TrimSuffix(path, ".meta")); err != nil {
+		return nil, nil
+	}
+
+	metadata, err := ReadMetadata(path)
+	if err != nil || nil == metadata || "" == metadata.Uri {
+		return nil, nil
+	}
+
+	metadata.Fetched = time.Time{}
+	return yaml.Marshal(metadata)
+}
+
+// NewStorage creates a new storage for the given vendor directory
+func NewStorage(format, dir string) (*Storage, error) {
+	switch format {
+	case ZipStorage, TarStorage, DirStorage, NoneStorage:
+		return &Storage{Format: format, Dir: dir}, nil
+	default:
+		return nil, fmt.Errorf("Unknown storage format %q, expected one of [%s, %s, %s, %s]", format, ZipStorage, TarStorage, DirStorage, NoneStorage)
+	}
+}
+
+// File returns the archive the vendor directory is stored in, or an empty string
+// if the format does not use one
+func (s *Storage) File() string {
+	switch s.Format {
+	case ZipStorage, TarStorage:
+		return s.Dir + "." + s.Format
+	default:
+		return ""
+	}
+}
+
+// Persistent returns whether the vendor directory itself is stored and must be kept
+func (s *Storage) Persistent() bool {
+	return DirStorage == s.Format
+}
+
+// Restore extracts the archive into the vendor directory, if it exists. Returns
+// whether anything was restored.
+func (s *Storage) Restore() (bool, error) {
+	file := s.File()
+	if "" == file {
+		return false, nil
+	} else if _, err := os.Stat(file); err != nil {
+		return false, nil
+	}
+
+	return true, s.extract(file, filepath.Dir(s.Dir))
+}
+
+// extract extracts the archive into the given directory. Only entries inside the vendor
+// directory are accepted, so an archive cannot overwrite any other files next to it.
+func (s *Storage) extract(file, parent string) error {
+	root := filepath.Base(s.Dir)
+	if ZipStorage == s.Format {
+		return unzip(file, parent, "", root)
+	}
+	return untar(file, parent, "", root, func(r io.Reader) (io.Reader, error) { return r, nil })
+}
+
+// Scratch creates a copy of the vendor directory inside the given directory, restoring it from
+// the archive first, so that it can be used without modifying either. Returns the copy's path.
+func (s *Storage) Scratch(parent string) (string, error) {
+	dir := filepath.Join(parent, filepath.Base(s.Dir))
+	if file := s.File(); "" != file {
+		if _, err := os.Stat(file); err == nil {
+			if err := s.extract(file, parent); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	err := filepath.Walk(s.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == s.Dir && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		name, err := filepath.Rel(s.Dir, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, name)
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, 0755)
+		case info.Mode().IsRegular():
+			return duplicate(path, target, info.Mode())
+		default:
+			return nil
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// duplicate copies a file
+func duplicate(src, dest string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Save stores the vendor directory in the archive. Returns whether it was written.
+func (s *Storage) Save(skipUnchanged bool) (bool, error) {
+	switch s.Format {
+	case ZipStorage:
+		return mkzip(s.Dir, s.File(), skipUnchanged)
+	case TarStorage:
+		return mktar(s.Dir, s.File(), skipUnchanged)
+	default:
+		return false, nil
+	}
+}
+
+// atomically writes a file by writing to a temporary file next to it first and then
+// renaming it, so that readers never see partially written contents
+func atomically(file string, content []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), file)
+}
+
+// persist stores the contents of the source directory in a file created by the given
+// function. The archive is reproducible: entries are sorted, and the function is expected
+// to normalize their timestamps and permissions. Incomplete downloads are not included, and
+// the time traits were fetched at is left out of their metadata, see sidecar().
+// It is written to a temporary file first and then renamed; if skipUnchanged is given and
+// the destination already has the same contents, it is left untouched. Returns whether the
+// destination was written.
+func persist(src, dest string, skipUnchanged bool, create func(entries []entry, file string) error) (bool, error) {
+	base := filepath.Dir(src)
+	entries := make([]entry, 0)
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == src && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		} else if strings.HasSuffix(path, ".part") || strings.HasSuffix(path, ".part.meta") {
+			return nil
+		}
+
+		name, err := filepath.Rel(base, path)
+		if err != nil {
+			return err
+		}
+		content, err := sidecar(path)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry{path: path, name: filepath.ToSlash(name), info: info, content: content})
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+
+	f, err := ioutil.TempFile(filepath.Dir(dest), "."+filepath.Base(dest)+".*")
+	if err != nil {
+		return false, err
+	}
+	f.Close()
+
+	temp := f.Name()
+	if err := create(entries, temp); err != nil {
+		os.Remove(temp)
+		return false, err
+	}
+	if err := os.Chmod(temp, 0644); err != nil {
+		os.Remove(temp)
+		return false, err
+	}
+
+	if skipUnchanged {
+		if _, err := os.Stat(dest); err == nil {
+			before, err := digest(dest)
+			if err != nil {
+				return false, err
+			}
+			after, err := digest(temp)
+			if err != nil {
+				return false, err
+			}
+			if before == after {
+				return false, os.Remove(temp)
+			}
+		}
+	}
+
+	return true, os.Rename(temp, dest)
+}
@@ -0,0 +1,152 @@
+package transform
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_unknown_storage_format(t *testing.T) {
+	_, err := NewStorage("7z", "doget_modules")
+	assertEqual("Unknown storage format \"7z\", expected one of [zip, tar, dir, none]", err.Error(), t)
+}
+
+func Test_storage_files(t *testing.T) {
+	for format, expected := range map[string]string{ZipStorage: "vendor/traits.zip", TarStorage: "vendor/traits.tar", DirStorage: "", NoneStorage: ""} {
+		storage, err := NewStorage(format, "vendor/traits")
+		if err != nil {
+			t.Error(err.Error())
+			continue
+		}
+		assertEqual(expected, storage.File(), t)
+	}
+}
+
+func Test_storage_roundtrip(t *testing.T) {
+	for _, format := range []string{ZipStorage, TarStorage} {
+		func() {
+			defer workspace(map[string]string{"vendor/traits/github.com/a/x/master/Dockerfile": "FROM debian:jessie\n"}, t)()
+
+			storage, _ := NewStorage(format, filepath.Join("vendor", "traits"))
+			if _, err := storage.Save(true); err != nil {
+				t.Error(err.Error())
+				return
+			}
+			os.RemoveAll(storage.Dir)
+
+			restored, err := storage.Restore()
+			if err != nil {
+				t.Error(err.Error())
+				return
+			}
+			assertEqual(true, restored, t)
+
+			content, _ := ioutil.ReadFile(filepath.Join(storage.Dir, "github.com", "a", "x", "master", "Dockerfile"))
+			assertEqual("FROM debian:jessie\n", string(content), t)
+		}()
+	}
+}
+
+func Test_tar_storage_is_reproducible(t *testing.T) {
+	defer workspace(map[string]string{"doget_modules/github.com/a/x/master/Dockerfile": "FROM debian:jessie\n"}, t)()
+
+	storage, _ := NewStorage(TarStorage, "doget_modules")
+	for _, expected := range []bool{true, false} {
+		written, err := storage.Save(true)
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		assertEqual(expected, written, t)
+	}
+}
+
+func Test_dir_storage_is_persistent(t *testing.T) {
+	for format, expected := range map[string]bool{ZipStorage: false, TarStorage: false, DirStorage: true, NoneStorage: false} {
+		storage, _ := NewStorage(format, "doget_modules")
+		assertEqual(expected, storage.Persistent(), t)
+	}
+}
+
+func Test_atomically_replaces_file(t *testing.T) {
+	defer workspace(map[string]string{"Dockerfile": "FROM debian:jessie\n"}, t)()
+
+	if err := atomically("Dockerfile", []byte("FROM alpine:3.6\n")); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	content, _ := ioutil.ReadFile("Dockerfile")
+	assertEqual("FROM alpine:3.6\n", string(content), t)
+	temporary, _ := filepath.Glob(".Dockerfile.*")
+	assertEqual(0, len(temporary), t)
+}
+
+func Test_storage_scratch_copies_archive_and_directory(t *testing.T) {
+	defer workspace(map[string]string{"doget_modules/github.com/a/x/master/Dockerfile": "FROM debian:jessie\n"}, t)()
+
+	storage, _ := NewStorage(ZipStorage, "doget_modules")
+	if _, err := storage.Save(true); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	os.RemoveAll(storage.Dir)
+	os.MkdirAll(filepath.Join(storage.Dir, "github.com", "a", "y", "master"), 0755)
+	ioutil.WriteFile(filepath.Join(storage.Dir, "github.com", "a", "y", "master", "Dockerfile"), []byte("FROM alpine:3.5\n"), 0644)
+
+	scratch := tempDir(t)
+	defer os.RemoveAll(scratch)
+	dir, err := storage.Scratch(scratch)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual(filepath.Join(scratch, "doget_modules"), dir, t)
+
+	restored, _ := ioutil.ReadFile(filepath.Join(dir, "github.com", "a", "x", "master", "Dockerfile"))
+	assertEqual("FROM debian:jessie\n", string(restored), t)
+	copied, _ := ioutil.ReadFile(filepath.Join(dir, "github.com", "a", "y", "master", "Dockerfile"))
+	assertEqual("FROM alpine:3.5\n", string(copied), t)
+
+	_, err = os.Stat(filepath.Join(storage.Dir, "github.com", "a", "x"))
+	assertEqual(true, os.IsNotExist(err), t)
+}
+
+func Test_restore_rejects_entries_outside_vendor_directory(t *testing.T) {
+	for _, name := range []string{"Dockerfile", ".git/hooks/pre-commit", "doget_modules/../doget.lock", "doget_modules_other/Dockerfile"} {
+		for _, format := range []string{ZipStorage, TarStorage} {
+			func() {
+				defer workspace(map[string]string{"Dockerfile": "FROM debian:jessie\n"}, t)()
+
+				files := map[string]string{"doget_modules/github.com/a/x/master/Dockerfile": "FROM debian:jessie\n", name: "pwned"}
+				content := archive(files, t)
+				if TarStorage == format {
+					var buf bytes.Buffer
+					w := tar.NewWriter(&buf)
+					for file, data := range files {
+						w.WriteHeader(&tar.Header{Name: file, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg})
+						w.Write([]byte(data))
+					}
+					w.Close()
+					content = buf.Bytes()
+				}
+
+				storage, _ := NewStorage(format, "doget_modules")
+				ioutil.WriteFile(storage.File(), content, 0644)
+				_, err := storage.Restore()
+				if err == nil {
+					t.Errorf("Expected an error for %s in %s, have none", name, format)
+					return
+				}
+				assertEqual(fmt.Sprintf("Rejected entry %q in %s: path lies outside doget_modules", name, storage.File()), err.Error(), t)
+
+				project, _ := ioutil.ReadFile("Dockerfile")
+				assertEqual("FROM debian:jessie\n", string(project), t)
+			}()
+		}
+	}
+}
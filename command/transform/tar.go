@@ -0,0 +1,58 @@
+package transform
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+)
+
+// mktar stores the contents of the source directory in an uncompressed tar file, see persist()
+func mktar(src, dest string, skipUnchanged bool) (bool, error) {
+	return persist(src, dest, skipUnchanged, func(entries []entry, file string) error {
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		w := tar.NewWriter(f)
+
+		// Closure to address file descriptors issue with all the deferred .Close() methods
+		add := func(e entry) error {
+			h := &tar.Header{Name: e.name, ModTime: epoch, Format: tar.FormatPAX}
+			if e.info.IsDir() {
+				h.Name += "/"
+				h.Typeflag = tar.TypeDir
+				h.Mode = 0755
+				return w.WriteHeader(h)
+			}
+
+			o, size, err := e.open()
+			if err != nil {
+				return err
+			}
+			defer o.Close()
+
+			h.Typeflag = tar.TypeReg
+			h.Mode = int64(permissions(e.info.Mode()))
+			h.Size = size
+			if err := w.WriteHeader(h); err != nil {
+				return err
+			}
+
+			_, err = io.Copy(w, o)
+			return err
+		}
+
+		for _, e := range entries {
+			if err := add(e); err != nil {
+				return err
+			}
+		}
+
+		if err := w.Close(); err != nil {
+			return err
+		}
+		return f.Close()
+	})
+}
@@ -3,21 +3,39 @@ package transform
 import (
 	"fmt"
 	"io"
-	"math"
 	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
 
+	"github.com/tueftler/doget/cache"
+	"github.com/tueftler/doget/client"
+	"github.com/tueftler/doget/config"
 	"github.com/tueftler/doget/dockerfile"
 	"github.com/tueftler/doget/provides"
 	"github.com/tueftler/doget/use"
 )
 
 type Transformation struct {
-	Input    string
-	Output   io.Writer
-	UseCache bool
+	Input      string
+	Output     io.Writer
+	Vendor     string
+	UseCache   bool
+	Offline    bool
+	VendorUrls bool
+	Plan       *Plan
+	Cache      *cache.Cache
+	Lock       *Lockfile
+	Duplicates *Duplicates
+	Workers    int
+	Replace    map[string]string
+	Client     *client.Client
+	graph      *Graph
+	fetcher    *Fetcher
+	workers    chan bool
+	pending    sync.WaitGroup
+	output     sync.Mutex
 }
 
 type Provided map[string]bool
@@ -70,8 +88,109 @@ func (t *Transformation) Run(parser *dockerfile.Parser) error {
 		return err
 	}
 
+	if "" == t.Vendor {
+		t.Vendor = config.Vendordir
+	}
+	if t.Lock == nil {
+		t.Lock = NewLockfile("")
+	}
+	if t.Duplicates == nil {
+		t.Duplicates, _ = NewDuplicates(Dedupe)
+	}
+	if t.Workers < 1 {
+		t.Workers = 1
+	}
+	if t.Client == nil {
+		t.Client, _ = client.New(client.Defaults(), nil)
+	}
+
+	// Resolve all traits before emitting anything. Fetching happens concurrently,
+	// verification is performed afterwards in statement order to yield stable results
+	t.fetcher = &Fetcher{UseCache: t.UseCache, Offline: t.Offline, Shared: t.Cache, Client: t.Client, Revalidate: t.Client.Options.Revalidate}
+	if 1 == t.Workers {
+		t.fetcher.Progress = progress
+	}
+	t.workers = make(chan bool, t.Workers)
+	t.graph = NewGraph(NewNode(t.Input, nil, directory(t.Input), &file))
+
+	t.resolve(parser, t.graph.Root)
+	t.pending.Wait()
+
+	if t.Offline {
+		if err := missing(t.graph); err != nil {
+			return err
+		}
+	}
+	if err := t.verify(t.graph.Root, Chain{}, make(map[*Node]bool)); err != nil {
+		return err
+	}
+	if err := t.graph.Select(); err != nil {
+		return err
+	}
+
+	// When planning, the output is written to verify PROVIDES, but the lockfile is left untouched
+	if t.Plan != nil {
+		t.Plan.collect(t.graph)
+	}
+
 	file.From.Emit(t.Output)
-	return t.write(parser, &file, "", Provided{file.From.Image: true})
+	if err := t.write(t.graph.Root, "", Provided{file.From.Image: true}, Chain{}); err != nil {
+		return err
+	}
+
+	if t.Plan != nil {
+		return t.Plan.failed()
+	}
+	return t.Lock.Save()
+}
+
+// directory returns the directory relative references in the given input resolve against
+func directory(input string) string {
+	if stat, err := os.Stat(input); err == nil && stat.IsDir() {
+		return input
+	}
+	return filepath.Dir(input)
+}
+
+// contextual returns a path relative to the build context, which is the current directory
+func contextual(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(cwd, abs)
+	if err != nil {
+		return path
+	}
+	return rel
+}
+
+// sources verifies local files referenced by ADD or COPY paths are available:
+// raw traits consist of their Dockerfile only, and files outside the build
+// context cannot be accessed by docker build
+func sources(node *Node, instruction, paths, base string) error {
+	local := false
+	segments := strings.Split(paths, " ")
+	for _, segment := range segments[0 : len(segments)-1] {
+		if !strings.Contains(segment, "://") {
+			local = true
+		}
+	}
+
+	switch {
+	case !local:
+		return nil
+	case nil != node.Origin && use.Raw == node.Origin.Type:
+		return fmt.Errorf("Cannot %s %s from %s, only its Dockerfile is downloaded", instruction, paths, node.Name)
+	case strings.HasPrefix(base, "../"):
+		return fmt.Errorf("Cannot %s %s from %s, it lies outside the build context", instruction, paths, node.Name)
+	default:
+		return nil
+	}
 }
 
 func prefix(paths, base string) string {
@@ -87,72 +206,258 @@ func prefix(paths, base string) string {
 	return result + segments[len(segments)-1]
 }
 
-func (t *Transformation) write(parser *dockerfile.Parser, file *dockerfile.Dockerfile, base string, provided Provided) error {
-	fmt.Fprintf(os.Stderr, "Transform : %s\n", file.Source)
-	for _, statement := range file.Statements {
-		switch statement.(type) {
-		case *provides.Statement:
-			for _, image := range statement.(*provides.Statement).Images() {
-				provided.add(image)
-				fmt.Fprintf(os.Stderr, " ---> PROVIDES %s\n", image)
-			}
-			break
+// resolve fetches all traits required by a given node concurrently, recursively
+func (t *Transformation) resolve(parser *dockerfile.Parser, node *Node) {
+	for _, statement := range node.File.Statements {
+		if reference, ok := statement.(*use.Statement); ok {
+			edge := &Edge{}
+			node.Requires[reference] = edge
 
-		case *use.Statement:
-			var path string
+			t.pending.Add(1)
+			go func(reference *use.Statement) {
+				defer t.pending.Done()
+				t.require(parser, node, reference, edge)
+			}(reference)
+		}
+	}
+}
 
-			origin, err := statement.(*use.Statement).Origin()
-			if err != nil {
-				return err
+// require resolves the trait referenced by a USE statement and fetches it unless already present in the graph
+func (t *Transformation) require(parser *dockerfile.Parser, parent *Node, statement *use.Statement, edge *Edge) {
+	edge.Origin, edge.Err = statement.Origin()
+	if edge.Err != nil {
+		return
+	}
+
+	// Relative references resolve against the including trait; inside remote
+	// traits, they refer to the same archive, which has already been fetched
+	inherited := edge.Origin.Relative && nil != parent.Origin && "" == parent.Origin.Local
+	if edge.Origin, edge.Err = edge.Origin.Within(parent.Origin, parent.Path); edge.Err != nil {
+		return
+	}
+
+	// Replacements are applied before anything is fetched, and always reported
+	replaced, err := replace(statement.Context, t.Replace, edge.Origin)
+	if err != nil {
+		edge.Err = err
+		return
+	} else if nil != replaced {
+		t.report(" ---> WARNING %s is replaced by %s\n", edge.Origin.String(), replaced.String())
+		edge.Replaces = edge.Origin.String()
+		edge.Origin = replaced
+	}
+
+	// Resolve version constraints, honoring locked versions
+	origin := edge.Origin
+	reference, replacement := origin.String(), ""
+	if "" != edge.Replaces {
+		reference, replacement = edge.Replaces, origin.String()
+	}
+
+	// Locks recorded with a different replacement are disregarded
+	locked, isLocked := t.Lock.Lookup(reference)
+	if isLocked && locked.Replace != replacement {
+		isLocked = false
+	}
+	if isLocked {
+		edge.Locked = locked
+	}
+
+	if "" != origin.Constraint {
+		t.workers <- true
+		if isLocked && "" != locked.Version {
+			edge.Err = statement.Context.Resolve(origin, locked.Version)
+		} else if t.Offline {
+			edge.Err = available(statement.Context, t.Vendor, origin)
+		} else {
+			edge.Err = resolve(statement.Context, origin, t.Client)
+		}
+		<-t.workers
+		if edge.Err != nil {
+			return
+		}
+	}
+
+	node, claimed := t.graph.Claim(origin)
+	edge.Node = node
+	if !claimed {
+		return
+	}
+
+	// Local traits are read directly from disk
+	if "" != origin.Local {
+		t.report(" ---> USE %s (local)\n", origin.String())
+		node.From = Local
+		node.Uri = origin.Local
+		node.Path = contextual(origin.Local)
+		node.File = &dockerfile.Dockerfile{}
+		if node.Err = load(parser, node.Path, node.File); node.Err != nil {
+			return
+		}
+		if node.Digest, node.Err = digest(node.File.Source); node.Err != nil {
+			return
+		}
+		node.Path = contextual(filepath.Dir(node.File.Source))
+
+		if "" != replacement {
+			t.Lock.Record(reference, &Lock{Replace: replacement, Dockerfile: node.Digest})
+		}
+
+		t.resolve(parser, node)
+		return
+	}
+
+	// Honor locked revision; if the archive's hash is known, the shared cache may be used
+	pinned := *origin
+	known := origin.Digest
+	if isLocked {
+		if node.Err = statement.Context.Resolve(&pinned, locked.Revision); node.Err != nil {
+			return
+		}
+		pinned.Uri = locked.Uri
+		known = locked.Archive
+	}
+
+	var fetched *Fetched
+	if inherited {
+		fetched = &Fetched{Path: filepath.Join(storage(t.Vendor, origin), origin.Dir), Revision: parent.Revision, Archive: parent.Archive, From: "from " + parent.Name}
+	} else {
+		var err error
+		t.workers <- true
+		fetched, err = t.fetcher.Fetch(&pinned, storage(t.Vendor, origin), known)
+		<-t.workers
+		if err != nil {
+			node.Err = err
+			return
+		}
+	}
+
+	t.report(" ---> USE %s (%s)\n", origin.String(), fetched.From)
+	node.Path = fetched.Path
+	node.Revision = fetched.Revision
+	node.Archive = fetched.Archive
+	node.From = fetched.From
+	node.File = &dockerfile.Dockerfile{}
+	if node.Err = load(parser, fetched.Path, node.File); node.Err != nil {
+		return
+	}
+
+	if node.Digest, node.Err = digest(node.File.Source); node.Err != nil {
+		return
+	}
+
+	if isLocked {
+		if node.Err = locked.Verify(origin.String(), "archive", locked.Archive, fetched.Archive); node.Err != nil {
+			return
+		}
+		if node.Err = locked.Verify(origin.String(), "Dockerfile", locked.Dockerfile, node.Digest); node.Err != nil {
+			return
+		}
+		node.Uri = locked.Uri
+	} else {
+		resolved := *origin
+		resolved.Version = fetched.Revision
+		uri, err := statement.Context.Uri(&resolved)
+		if err != nil {
+			node.Err = err
+			return
+		}
+		node.Uri = uri
+
+		t.Lock.Record(reference, &Lock{Uri: uri, Replace: replacement, Version: origin.Version, Revision: fetched.Revision, Archive: fetched.Archive, Dockerfile: node.Digest})
+	}
+
+	t.resolve(parser, node)
+}
+
+// verify checks all requirements of a given node in statement order, detecting
+// cycles, verifying integrity and recording requirements for version selection
+func (t *Transformation) verify(node *Node, parents Chain, visited map[*Node]bool) error {
+	visited[node] = true
+	for _, statement := range node.File.Statements {
+		if reference, ok := statement.(*use.Statement); ok {
+			chain := parents.Push(node.Name, reference.Line)
+			edge := node.Requires[reference]
+			if nil != edge.Err {
+				return wrap(chain, edge.Err)
 			}
 
-			path, err = fetch(origin, t.UseCache, func(transferred, total int64) {
-				percentage := float64(transferred) / float64(total)
-				finished := int(math.Max(percentage*float64(40), 40))
-				fmt.Fprintf(
-					os.Stderr,
-					"\r ---> Transferring [%s%s] %.2fkB",
-					strings.Repeat("#", finished),
-					strings.Repeat("_", 40-finished),
-					float64(transferred)/float64(1024),
-				)
-			})
-			fmt.Fprintf(os.Stderr, "\n")
+			if chain.Contains(edge.Node.Name) {
+				return &CycleError{Chain: chain, Origin: edge.Node.Name}
+			}
 
-			if err != nil {
-				return err
+			if nil != edge.Node.Err {
+				return wrap(chain, edge.Node.Err)
 			}
 
-			var included dockerfile.Dockerfile
-			if err := load(parser, path, &included); err != nil {
-				return err
+			if err := integrity(edge.Origin, edge.Node.Archive, edge.Node.Digest, edge.Locked); err != nil {
+				return wrap(chain, err)
 			}
 
-			if !provided.contains(included.From.Image) {
-				return fmt.Errorf(
-					"Include %s requires %s, which was not found in provided %s",
-					origin.String(),
-					included.From.Image,
-					reflect.ValueOf(provided).MapKeys(),
-				)
+			t.graph.Require(edge.Node, edge.Origin.Constraint, chain)
+			if !visited[edge.Node] {
+				if err := t.verify(edge.Node, chain, visited); err != nil {
+					return err
+				}
 			}
+		}
+	}
+
+	return nil
+}
 
-			dockerfile.EmitComment(t.Output, "Included from "+origin.String())
-			t.write(parser, &included, filepath.ToSlash(path)+"/", provided)
+// report writes progress information
+func (t *Transformation) report(format string, args ...interface{}) {
+	t.output.Lock()
+	defer t.output.Unlock()
+
+	fmt.Fprintf(os.Stderr, format, args...)
+}
+
+func (t *Transformation) write(node *Node, base string, provided Provided, parents Chain) error {
+	fmt.Fprintf(os.Stderr, "Transform : %s\n", node.File.Source)
+	for _, statement := range node.File.Statements {
+		switch statement.(type) {
+		case *provides.Statement:
+			for _, image := range statement.(*provides.Statement).Images() {
+				provided.add(image)
+				fmt.Fprintf(os.Stderr, " ---> PROVIDES %s\n", image)
+			}
+			break
+
+		case *use.Statement:
+			chain := parents.Push(node.Name, statement.(*use.Statement).Line)
+			if err := t.include(node.Requires[statement.(*use.Statement)], chain, provided); err != nil {
+				return wrap(chain, err)
+			}
 			break
 
 		// Remove "FROM"
 		case *dockerfile.From:
 			break
 
-		// Prefix "ADD" paths:
+		// Prefix "ADD" paths, vendoring remote ones if requested:
 		case *dockerfile.Add:
-			dockerfile.EmitInstruction(t.Output, "ADD", prefix(statement.(*dockerfile.Add).Paths, base))
+			paths := statement.(*dockerfile.Add).Paths
+			if err := sources(node, "ADD", paths, base); err != nil {
+				return err
+			}
+			instructions, err := t.add(paths, base)
+			if err != nil {
+				return err
+			}
+			for _, instruction := range instructions {
+				dockerfile.EmitInstruction(t.Output, instruction.name, instruction.value)
+			}
 			break
 
 		// Prefix "COPY" paths:
 		case *dockerfile.Copy:
-			dockerfile.EmitInstruction(t.Output, "COPY", prefix(statement.(*dockerfile.Copy).Paths, base))
+			paths := statement.(*dockerfile.Copy).Paths
+			if err := sources(node, "COPY", paths, base); err != nil {
+				return err
+			}
+			dockerfile.EmitInstruction(t.Output, "COPY", prefix(paths, base))
 			break
 
 		default:
@@ -163,3 +468,31 @@ func (t *Transformation) write(parser *dockerfile.Parser, file *dockerfile.Docke
 
 	return nil
 }
+
+// include writes the version selected for a required trait
+func (t *Transformation) include(required *Edge, chain Chain, provided Provided) error {
+	selected := t.graph.Selection(required.Node.Origin)
+	if seen, err := t.Duplicates.Seen(selected.Origin.String(), chain); seen || err != nil {
+		return err
+	}
+
+	// When planning, failed checks are recorded and reported once all checks are performed
+	ok := provided.contains(selected.File.From.Image)
+	if t.Plan != nil {
+		t.Plan.check(selected.Origin.String(), selected.File.From.Image, ok)
+	} else if !ok {
+		return fmt.Errorf(
+			"Include %s requires %s, which was not found in provided %s",
+			selected.Origin.String(),
+			selected.File.From.Image,
+			reflect.ValueOf(provided).MapKeys(),
+		)
+	}
+
+	comment := "Included from " + selected.Origin.String()
+	if "" != required.Replaces {
+		comment += " replacing " + required.Replaces
+	}
+	dockerfile.EmitComment(t.Output, comment)
+	return t.write(selected, filepath.ToSlash(selected.Path)+"/", provided, chain)
+}
@@ -0,0 +1,311 @@
+package transform
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tueftler/doget/config"
+	"github.com/tueftler/doget/dockerfile"
+	"github.com/tueftler/doget/provides"
+	"github.com/tueftler/doget/use"
+)
+
+// workspace creates a temporary working directory with the given files,
+// changes into it and returns a function to restore the previous state
+func workspace(files map[string]string, t *testing.T) func() {
+	dir := tempDir(t)
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err.Error())
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	return func() {
+		os.Chdir(cwd)
+		os.RemoveAll(dir)
+	}
+}
+
+// cached returns the path to a trait's Dockerfile inside the vendor directory, e.g. github.com/a/x/master
+func cached(trait string) string {
+	return config.Vendordir + "/" + trait + "/Dockerfile"
+}
+
+func transform(t *testing.T) (string, error) {
+	parser := dockerfile.NewParser().
+		Extend("USE", use.New(config.Default().Repositories).Extension).
+		Extend("PROVIDES", provides.Extension)
+
+	var buf bytes.Buffer
+	transformation := Transformation{Input: "Dockerfile.in", Output: &buf, UseCache: true, Workers: 4}
+	err := transformation.Run(parser)
+	return buf.String(), err
+}
+
+func Test_transform_includes_trait(t *testing.T) {
+	defer workspace(map[string]string{
+		"Dockerfile.in":                 "FROM debian:jessie\nUSE github.com/a/x\n",
+		cached("github.com/a/x/master"): "FROM debian:jessie\nRUN echo x\n",
+	}, t)()
+
+	out, err := transform(t)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual("FROM debian:jessie\n\n# Included from github.com/a/x:master\nRUN echo x\n\n", out, t)
+}
+
+func Test_transform_reports_include_chain(t *testing.T) {
+	defer workspace(map[string]string{
+		"Dockerfile.in":                 "FROM debian:jessie\n\nUSE github.com/a/x\n",
+		cached("github.com/a/x/master"): "FROM debian:jessie\nUSE github.com/b/y\n",
+		cached("github.com/b/y/master"): "FROM debian:jessie\nUSE example.com/c/z\n",
+	}, t)()
+
+	_, err := transform(t)
+	if err == nil {
+		t.Error("Expected an error, have none")
+		return
+	}
+	assertEqual("Dockerfile.in:3 -> github.com/a/x:master:2 -> github.com/b/y:master:2: No repository example.com", err.Error(), t)
+}
+
+func Test_transform_detects_cycle(t *testing.T) {
+	defer workspace(map[string]string{
+		"Dockerfile.in":                 "FROM debian:jessie\n\n\nUSE github.com/a/x\n",
+		cached("github.com/a/x/master"): "FROM debian:jessie\nRUN echo x\nUSE github.com/b/y\n",
+		cached("github.com/b/y/master"): "FROM debian:jessie\nUSE github.com/a/x\n",
+	}, t)()
+
+	_, err := transform(t)
+	if err == nil {
+		t.Error("Expected an error, have none")
+		return
+	}
+	assertEqual("Include cycle detected: Dockerfile.in:4 -> github.com/a/x:master:3 -> github.com/b/y:master:2 -> github.com/a/x:master", err.Error(), t)
+}
+
+func Test_transform_includes_common_trait_once(t *testing.T) {
+	defer workspace(map[string]string{
+		"Dockerfile.in":                    "FROM debian:jessie\nUSE github.com/a/x\nUSE github.com/b/y\n",
+		cached("github.com/a/x/master"):    "FROM debian:jessie\nUSE github.com/c/base\nRUN echo x\n",
+		cached("github.com/b/y/master"):    "FROM debian:jessie\nUSE github.com/c/base\nRUN echo y\n",
+		cached("github.com/c/base/master"): "FROM debian:jessie\nRUN echo base\n",
+	}, t)()
+
+	out, err := transform(t)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual(
+		"FROM debian:jessie\n\n"+
+			"# Included from github.com/a/x:master\n"+
+			"# Included from github.com/c/base:master\nRUN echo base\n\n"+
+			"RUN echo x\n\n"+
+			"# Included from github.com/b/y:master\nRUN echo y\n\n",
+		out,
+		t,
+	)
+}
+
+func Test_transform_selects_highest_version_of_common_trait(t *testing.T) {
+	defer workspace(map[string]string{
+		"Dockerfile.in":                    "FROM debian:jessie\nUSE github.com/a/x\nUSE github.com/b/y\n",
+		cached("github.com/a/x/master"):    "FROM debian:jessie\nUSE github.com/c/base:v1.0.0\n",
+		cached("github.com/b/y/master"):    "FROM debian:jessie\nUSE github.com/c/base:v1.1.0\n",
+		cached("github.com/c/base/v1.0.0"): "FROM debian:jessie\nRUN echo base v1.0.0\n",
+		cached("github.com/c/base/v1.1.0"): "FROM debian:jessie\nRUN echo base v1.1.0\n",
+	}, t)()
+
+	out, err := transform(t)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual(
+		"FROM debian:jessie\n\n"+
+			"# Included from github.com/a/x:master\n"+
+			"# Included from github.com/c/base:v1.1.0\nRUN echo base v1.1.0\n\n"+
+			"# Included from github.com/b/y:master\n",
+		out,
+		t,
+	)
+}
+
+func Test_transform_reports_version_conflicts(t *testing.T) {
+	defer workspace(map[string]string{
+		"Dockerfile.in":                     "FROM debian:jessie\nUSE github.com/a/x\nUSE github.com/b/y\n",
+		cached("github.com/a/x/master"):     "FROM debian:jessie\nUSE github.com/c/base:develop\n",
+		cached("github.com/b/y/master"):     "FROM debian:jessie\nUSE github.com/c/base:v2\n",
+		cached("github.com/c/base/develop"): "FROM debian:jessie\nRUN echo base\n",
+		cached("github.com/c/base/v2"):      "FROM debian:jessie\nRUN echo base\n",
+	}, t)()
+
+	out, err := transform(t)
+	if err == nil {
+		t.Error("Expected an error, have none")
+		return
+	}
+	assertEqual("Cannot select a version of github.com/c/base: develop required by Dockerfile.in:2 -> github.com/a/x:master:2, v2 required by Dockerfile.in:3 -> github.com/b/y:master:2", err.Error(), t)
+	assertEqual("", out, t)
+}
+
+func Test_transform_prefixes_paths_with_versioned_directory(t *testing.T) {
+	defer workspace(map[string]string{
+		"Dockerfile.in":                       "FROM debian:jessie\nUSE github.com/a/x:feature/copy\n",
+		cached("github.com/a/x/feature-copy"): "FROM debian:jessie\nCOPY etc/x.conf /etc/x.conf\n",
+	}, t)()
+
+	out, err := transform(t)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual("FROM debian:jessie\n\n# Included from github.com/a/x:feature/copy\nCOPY doget_modules/github.com/a/x/feature-copy/etc/x.conf /etc/x.conf\n\n", out, t)
+}
+
+func Test_transform_output_order_independent_of_workers(t *testing.T) {
+	defer workspace(map[string]string{
+		"Dockerfile.in":                 "FROM debian:jessie\nUSE github.com/a/x\nUSE github.com/b/y\nUSE github.com/c/z\n",
+		cached("github.com/a/x/master"): "FROM debian:jessie\nUSE github.com/c/z\nRUN echo x\n",
+		cached("github.com/b/y/master"): "FROM debian:jessie\nRUN echo y\n",
+		cached("github.com/c/z/master"): "FROM debian:jessie\nRUN echo z\n",
+	}, t)()
+
+	parser := dockerfile.NewParser().Extend("USE", use.New(config.Default().Repositories).Extension)
+	outputs := make([]string, 0)
+	for _, workers := range []int{1, 2, 8} {
+		var buf bytes.Buffer
+		transformation := Transformation{Input: "Dockerfile.in", Output: &buf, UseCache: true, Workers: workers}
+		if err := transformation.Run(parser); err != nil {
+			t.Error(err.Error())
+			return
+		}
+		outputs = append(outputs, buf.String())
+	}
+
+	assertEqual(outputs[0], outputs[1], t)
+	assertEqual(outputs[0], outputs[2], t)
+}
+
+func Test_transform_offline_lists_missing_traits(t *testing.T) {
+	defer workspace(map[string]string{
+		"Dockerfile.in":                 "FROM debian:jessie\nUSE github.com/a/x\nUSE github.com/c/z:^1.0\nUSE github.com/b/y\n",
+		cached("github.com/a/x/master"): "FROM debian:jessie\nRUN echo x\n",
+	}, t)()
+
+	parser := dockerfile.NewParser().Extend("USE", use.New(config.Default().Repositories).Extension)
+	var buf bytes.Buffer
+	transformation := Transformation{Input: "Dockerfile.in", Output: &buf, UseCache: true, Offline: true, Workers: 4}
+	err := transformation.Run(parser)
+	if err == nil {
+		t.Error("Expected an error, have none")
+		return
+	}
+	assertEqual("Cannot transform offline, the following traits are missing:\n  - github.com/b/y:master\n  - github.com/c/z:^1.0", err.Error(), t)
+}
+
+func Test_transform_offline_resolves_constraints_against_vendor_directory(t *testing.T) {
+	defer workspace(map[string]string{
+		"Dockerfile.in":                 "FROM debian:jessie\nUSE github.com/a/x:^1.0\n",
+		cached("github.com/a/x/v1.1.0"): "FROM debian:jessie\nRUN echo 1.1\n",
+		cached("github.com/a/x/v1.2.0"): "FROM debian:jessie\nRUN echo 1.2\n",
+		cached("github.com/a/x/v2.0.0"): "FROM debian:jessie\nRUN echo 2.0\n",
+	}, t)()
+
+	parser := dockerfile.NewParser().Extend("USE", use.New(config.Default().Repositories).Extension)
+	var buf bytes.Buffer
+	transformation := Transformation{Input: "Dockerfile.in", Output: &buf, UseCache: true, Offline: true, Workers: 4}
+	if err := transformation.Run(parser); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual("FROM debian:jessie\n\n# Included from github.com/a/x:v1.2.0\nRUN echo 1.2\n\n", buf.String(), t)
+}
+
+func Test_transform_includes_local_trait(t *testing.T) {
+	defer workspace(map[string]string{
+		"Dockerfile.in":            "FROM debian:jessie\nUSE ./traits/php\n",
+		"traits/php/Dockerfile":    "FROM debian:jessie\nUSE ../common\nCOPY php.ini /etc/php.ini\n",
+		"traits/common/Dockerfile": "FROM debian:jessie\nRUN echo common\n",
+	}, t)()
+
+	out, err := transform(t)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual("FROM debian:jessie\n\n# Included from traits/php\n# Included from traits/common\nRUN echo common\n\nCOPY traits/php/php.ini /etc/php.ini\n\n", out, t)
+}
+
+func Test_transform_resolves_relative_references_inside_remote_trait(t *testing.T) {
+	defer workspace(map[string]string{
+		"Dockerfile.in":                             "FROM debian:jessie\nUSE github.com/a/traits/php:v1.0.0\n",
+		cached("github.com/a/traits/v1.0.0/php"):    "FROM debian:jessie\nUSE ../common\n",
+		cached("github.com/a/traits/v1.0.0/common"): "FROM debian:jessie\nCOPY etc /etc\n",
+	}, t)()
+
+	out, err := transform(t)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual("FROM debian:jessie\n\n# Included from github.com/a/traits/php:v1.0.0\n# Included from github.com/a/traits/common:v1.0.0\nCOPY doget_modules/github.com/a/traits/v1.0.0/common/etc /etc\n\n", out, t)
+}
+
+func Test_transform_refuses_copy_from_outside_build_context(t *testing.T) {
+	defer workspace(map[string]string{
+		"project/Dockerfile.in": "FROM debian:jessie\nUSE ../traits/php\n",
+		"traits/php/Dockerfile": "FROM debian:jessie\nCOPY php.ini /etc/php.ini\n",
+	}, t)()
+	os.Chdir("project")
+
+	_, err := transform(t)
+	if err == nil {
+		t.Error("Expected an error, have none")
+		return
+	}
+	assertEqual("Dockerfile.in:2: Cannot COPY php.ini /etc/php.ini from ../traits/php, it lies outside the build context", err.Error(), t)
+}
+
+func Test_transform_applies_replacements(t *testing.T) {
+	defer workspace(map[string]string{
+		"Dockerfile.in":      "FROM debian:jessie\nUSE github.com/acme/traits/php:v1.0.0\n",
+		"dev/php/Dockerfile": "FROM debian:jessie\nRUN echo dev\n",
+	}, t)()
+
+	parser := dockerfile.NewParser().Extend("USE", use.New(config.Default().Repositories).Extension)
+	var buf bytes.Buffer
+	lock := NewLockfile(config.Lockfile)
+	transformation := Transformation{
+		Input:   "Dockerfile.in",
+		Output:  &buf,
+		Lock:    lock,
+		Replace: map[string]string{"github.com/acme/traits/php": "./dev/php"},
+	}
+	if err := transformation.Run(parser); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual("FROM debian:jessie\n\n# Included from dev/php replacing github.com/acme/traits/php:v1.0.0\nRUN echo dev\n\n", buf.String(), t)
+
+	locked, _ := lock.Lookup("github.com/acme/traits/php:v1.0.0")
+	assertEqual("dev/php", locked.Replace, t)
+}
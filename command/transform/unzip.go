@@ -3,12 +3,15 @@ package transform
 import (
 	"archive/zip"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
-	"strings"
 )
 
-func unzip(src, dest string, base *strings.Replacer) error {
+// unzip extracts a zip archive. Symbolic links are not extracted, but rejected if
+// their targets lie outside the destination directory. If a root is given, entries
+// outside of it are rejected.
+func unzip(src, dest, prefix, root string) error {
 	r, err := zip.OpenReader(src)
 	if err != nil {
 		return err
@@ -16,30 +19,42 @@ func unzip(src, dest string, base *strings.Replacer) error {
 	defer r.Close()
 
 	os.MkdirAll(dest, 0755)
+	g := newGuard(src, dest, root)
 
 	// Closure to address file descriptors issue with all the deferred .Close() methods
 	extract := func(f *zip.File) error {
+		path, err := g.path(f.Name, prefix)
+		if err != nil {
+			return err
+		}
+
 		rc, err := f.Open()
 		if err != nil {
 			return err
 		}
 		defer rc.Close()
 
-		path := filepath.Join(dest, base.Replace(f.Name))
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			os.MkdirAll(path, 0755)
 
-		if f.FileInfo().IsDir() {
-			os.MkdirAll(path, f.Mode())
-		} else {
-			f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
+		case mode&os.ModeSymlink != 0:
+			target, err := ioutil.ReadAll(io.LimitReader(rc, 4096))
 			if err != nil {
 				return err
 			}
-			defer f.Close()
+			return g.link(f.Name, path, string(target))
 
-			_, err = io.Copy(f, rc)
+		case mode.IsRegular():
+			os.MkdirAll(filepath.Dir(path), 0755)
+			out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, permissions(mode))
 			if err != nil {
 				return err
 			}
+			defer out.Close()
+
+			return g.copy(f.Name, out, rc)
 		}
 		return nil
 	}
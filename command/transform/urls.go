@@ -0,0 +1,137 @@
+package transform
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/tueftler/doget/auth"
+)
+
+// instruction is a Dockerfile instruction to be emitted along with its arguments
+type instruction struct {
+	name  string
+	value string
+}
+
+// remote returns whether an ADD source is a URL downloaded by docker build
+func remote(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// add rewrites an ADD instruction. If vendoring URLs is enabled, remote sources are downloaded
+// into the vendor directory and added from there using COPY: Docker does not extract archives
+// downloaded from URLs, but would extract them when added from the build context. Local sources
+// keep using ADD. Flags only applying to remote sources are verified and dropped.
+func (t *Transformation) add(paths, base string) ([]instruction, error) {
+	segments := strings.Fields(paths)
+	if !t.VendorUrls || strings.HasPrefix(paths, "[") || len(segments) < 2 {
+		return []instruction{{"ADD", prefix(paths, base)}}, nil
+	}
+
+	flags, locals, remotes := make([]string, 0), make([]string, 0), make([]string, 0)
+	checksum := ""
+	for _, segment := range segments[0 : len(segments)-1] {
+		switch {
+		case strings.HasPrefix(segment, "--checksum="):
+			checksum = strings.TrimPrefix(segment, "--checksum=")
+		case strings.HasPrefix(segment, "--keep-git-dir"):
+			// Applies to git sources only
+		case strings.HasPrefix(segment, "--"):
+			flags = append(flags, segment)
+		case remote(segment):
+			remotes = append(remotes, segment)
+		default:
+			locals = append(locals, base+segment)
+		}
+	}
+	if 0 == len(remotes) {
+		return []instruction{{"ADD", prefix(paths, base)}}, nil
+	}
+
+	dest := segments[len(segments)-1]
+	vendored := make([]string, len(remotes))
+	for i, uri := range remotes {
+		file, err := t.vendor(uri, checksum)
+		if err != nil {
+			return nil, err
+		}
+		vendored[i] = file
+	}
+
+	result := make([]instruction, 0)
+	if len(locals) > 0 {
+		result = append(result, instruction{"ADD", arguments(flags, locals, dest)})
+	}
+	return append(result, instruction{"COPY", arguments(flags, vendored, dest)}), nil
+}
+
+// arguments joins flags, sources and destination of an instruction
+func arguments(flags, sources []string, dest string) string {
+	return strings.Join(append(append(append([]string{}, flags...), sources...), dest), " ")
+}
+
+// vendor downloads a remote file into the vendor directory unless it is already present there,
+// verifying it against the hash recorded in the lockfile and the given checksum, if any. The
+// file keeps its name so that destinations ending with a slash yield the same path as before.
+// Returns its path relative to the build context.
+func (t *Transformation) vendor(uri, checksum string) (string, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return "", fmt.Errorf("Cannot vendor %s: %s", auth.Redact(uri), err.Error())
+	}
+	name := path.Base(parsed.Path)
+	if "." == name || "/" == name {
+		name = "download"
+	}
+	id := sha256.Sum256([]byte(uri))
+	file := filepath.Join(t.Vendor, "urls", hex.EncodeToString(id[:])[0:16], name)
+
+	locked, isLocked := t.Lock.Vendored(uri)
+	if _, err := os.Stat(file); err != nil || !t.UseCache {
+		shared := isLocked && t.Cache != nil && t.Cache.Contains(locked.Digest)
+		if t.Offline && !shared {
+			return "", fmt.Errorf("File %s is not available offline", auth.Redact(uri))
+		}
+
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return "", err
+		}
+		if shared {
+			if err := t.Cache.Populate(locked.Digest, file); err != nil {
+				return "", err
+			}
+		} else if _, _, err := download(uri, file, nil, t.Client, nil); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(os.Stderr, " ---> Vendored %s\n", auth.Redact(uri))
+	}
+
+	hash, err := digest(file)
+	if err != nil {
+		return "", err
+	}
+	if "" != checksum && checksum != hash {
+		return "", fmt.Errorf("Checksum mismatch for %s: expected %s, have %s", auth.Redact(uri), checksum, hash)
+	}
+	if isLocked && locked.Digest != hash {
+		return "", fmt.Errorf("Hash mismatch for %s: locked %s, have %s", auth.Redact(uri), locked.Digest, hash)
+	}
+
+	if t.Cache != nil && !t.Cache.Contains(hash) {
+		if err := t.Cache.Store(file, hash); err != nil {
+			return "", err
+		}
+	}
+
+	relative := filepath.ToSlash(contextual(file))
+	if !isLocked || locked.Path != relative {
+		t.Lock.RecordVendored(uri, &Vendored{Path: relative, Digest: hash})
+	}
+	return relative, nil
+}
@@ -0,0 +1,156 @@
+package transform
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"testing"
+
+	"github.com/tueftler/doget/config"
+	"github.com/tueftler/doget/dockerfile"
+	"github.com/tueftler/doget/use"
+)
+
+func vendorUrls(lock *Lockfile, offline bool) (string, error) {
+	parser := dockerfile.NewParser().Extend("USE", use.New(config.Default().Repositories).Extension)
+
+	var buf bytes.Buffer
+	transformation := Transformation{Input: "Dockerfile.in", Output: &buf, UseCache: true, Offline: offline, VendorUrls: true, Lock: lock}
+	err := transformation.Run(parser)
+	return buf.String(), err
+}
+
+// vendored returns the path a given URL is vendored to
+func vendored(uri, name string) string {
+	id := sha256.Sum256([]byte(uri))
+	return config.Vendordir + "/urls/" + hex.EncodeToString(id[:])[0:16] + "/" + name
+}
+
+func Test_remote(t *testing.T) {
+	assertEqual(true, remote("https://example.com/app.tar.gz"), t)
+	assertEqual(true, remote("http://example.com/app.tar.gz"), t)
+	assertEqual(false, remote("app.tar.gz"), t)
+	assertEqual(false, remote("git@github.com:a/x.git"), t)
+}
+
+func Test_add_left_untouched_unless_vendoring(t *testing.T) {
+	transformation := Transformation{}
+	instructions, err := transformation.add("https://example.com/app.tar.gz /opt/", "")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual([]instruction{{"ADD", "https://example.com/app.tar.gz /opt/"}}, instructions, t)
+}
+
+func Test_transform_vendors_remote_add(t *testing.T) {
+	server := serve(map[string]string{"/app.tar.gz": "archive"})
+	defer server.Close()
+	uri := server.URL + "/app.tar.gz"
+	defer workspace(map[string]string{"Dockerfile.in": "FROM debian:jessie\nADD " + uri + " /opt/\n"}, t)()
+
+	lock := NewLockfile("")
+	out, err := vendorUrls(lock, false)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual("FROM debian:jessie\n\nCOPY "+vendored(uri, "app.tar.gz")+" /opt/\n\n", out, t)
+
+	content, _ := ioutil.ReadFile(vendored(uri, "app.tar.gz"))
+	assertEqual("archive", string(content), t)
+
+	locked, _ := lock.Vendored(uri)
+	hash := sha256.Sum256([]byte("archive"))
+	assertEqual(&Vendored{Path: vendored(uri, "app.tar.gz"), Digest: "sha256:" + hex.EncodeToString(hash[:])}, locked, t)
+}
+
+func Test_transform_keeps_local_sources_in_add(t *testing.T) {
+	server := serve(map[string]string{"/app.conf": "conf"})
+	defer server.Close()
+	uri := server.URL + "/app.conf"
+	defer workspace(map[string]string{
+		"Dockerfile.in": "FROM debian:jessie\nADD --chown=app:app local.tar.gz " + uri + " /opt/\n",
+		"local.tar.gz":  "archive",
+	}, t)()
+
+	out, err := vendorUrls(NewLockfile(""), false)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual("FROM debian:jessie\n\nADD --chown=app:app local.tar.gz /opt/\n\nCOPY --chown=app:app "+vendored(uri, "app.conf")+" /opt/\n\n", out, t)
+}
+
+func Test_transform_keeps_given_chmod(t *testing.T) {
+	server := serve(map[string]string{"/app.sh": "#!/bin/sh"})
+	defer server.Close()
+	uri := server.URL + "/app.sh"
+	defer workspace(map[string]string{"Dockerfile.in": "FROM debian:jessie\nADD --chmod=755 " + uri + " /usr/bin/app\n"}, t)()
+
+	out, err := vendorUrls(NewLockfile(""), false)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual("FROM debian:jessie\n\nCOPY --chmod=755 "+vendored(uri, "app.sh")+" /usr/bin/app\n\n", out, t)
+}
+
+func Test_transform_verifies_checksum_flag(t *testing.T) {
+	server := serve(map[string]string{"/app.conf": "conf"})
+	defer server.Close()
+	uri := server.URL + "/app.conf"
+	defer workspace(map[string]string{"Dockerfile.in": "FROM debian:jessie\nADD --checksum=sha256:aa " + uri + " /etc/\n"}, t)()
+
+	_, err := vendorUrls(NewLockfile(""), false)
+	if err == nil {
+		t.Error("Expected an error, have none")
+		return
+	}
+	hash := sha256.Sum256([]byte("conf"))
+	assertEqual("Checksum mismatch for "+uri+": expected sha256:aa, have sha256:"+hex.EncodeToString(hash[:]), err.Error(), t)
+}
+
+func Test_transform_verifies_locked_hash(t *testing.T) {
+	server := serve(map[string]string{"/app.conf": "changed"})
+	defer server.Close()
+	uri := server.URL + "/app.conf"
+	defer workspace(map[string]string{"Dockerfile.in": "FROM debian:jessie\nADD " + uri + " /etc/\n"}, t)()
+
+	lock := NewLockfile("")
+	lock.RecordVendored(uri, &Vendored{Path: vendored(uri, "app.conf"), Digest: "sha256:aa"})
+	_, err := vendorUrls(lock, false)
+	if err == nil {
+		t.Error("Expected an error, have none")
+		return
+	}
+	hash := sha256.Sum256([]byte("changed"))
+	assertEqual("Hash mismatch for "+uri+": locked sha256:aa, have sha256:"+hex.EncodeToString(hash[:]), err.Error(), t)
+}
+
+func Test_transform_uses_vendored_file_offline(t *testing.T) {
+	uri := "https://example.com/app.conf"
+	defer workspace(map[string]string{
+		"Dockerfile.in":           "FROM debian:jessie\nADD " + uri + " /etc/\n",
+		vendored(uri, "app.conf"): "conf",
+	}, t)()
+
+	out, err := vendorUrls(NewLockfile(""), true)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual("FROM debian:jessie\n\nCOPY "+vendored(uri, "app.conf")+" /etc/\n\n", out, t)
+}
+
+func Test_transform_offline_refuses_missing_file(t *testing.T) {
+	defer workspace(map[string]string{"Dockerfile.in": "FROM debian:jessie\nADD https://example.com/app.conf /etc/\n"}, t)()
+
+	_, err := vendorUrls(NewLockfile(""), true)
+	if err == nil {
+		t.Error("Expected an error, have none")
+		return
+	}
+	assertEqual("File https://example.com/app.conf is not available offline", err.Error(), t)
+}
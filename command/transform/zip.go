@@ -4,38 +4,37 @@ import (
 	"archive/zip"
 	"io"
 	"os"
-	"path/filepath"
 )
 
-func mkzip(src, dest string) error {
-	f, err := os.Create(dest)
-	if err != nil {
-		return err
-	}
-
-	w := zip.NewWriter(f)
-	defer w.Close()
-
-	filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+// mkzip stores the contents of the source directory in a zip file, see persist()
+func mkzip(src, dest string, skipUnchanged bool) (bool, error) {
+	return persist(src, dest, skipUnchanged, func(entries []entry, file string) error {
+		f, err := os.Create(file)
 		if err != nil {
 			return err
-		} else if info.IsDir() {
-			_, err := w.CreateHeader(&zip.FileHeader{Name: filepath.ToSlash(path), ExternalAttrs: 0x10})
-			return err
-		} else {
-			o, err := os.Open(path)
-			if err != nil {
+		}
+		defer f.Close()
+
+		w := zip.NewWriter(f)
+
+		// Closure to address file descriptors issue with all the deferred .Close() methods
+		add := func(e entry) error {
+			h := &zip.FileHeader{Name: e.name, Modified: epoch}
+			if e.info.IsDir() {
+				h.Name += "/"
+				h.SetMode(os.ModeDir | 0755)
+				_, err := w.CreateHeader(h)
 				return err
 			}
-			defer o.Close()
 
-			h, err := zip.FileInfoHeader(info)
+			o, _, err := e.open()
 			if err != nil {
 				return err
 			}
+			defer o.Close()
 
-			// modify to provide full path name
-			h.Name = filepath.ToSlash(path)
+			h.Method = zip.Deflate
+			h.SetMode(permissions(e.info.Mode()))
 			z, err := w.CreateHeader(h)
 			if err != nil {
 				return err
@@ -44,7 +43,16 @@ func mkzip(src, dest string) error {
 			_, err = io.Copy(z, o)
 			return err
 		}
-	})
 
-	return nil
+		for _, e := range entries {
+			if err := add(e); err != nil {
+				return err
+			}
+		}
+
+		if err := w.Close(); err != nil {
+			return err
+		}
+		return f.Close()
+	})
 }
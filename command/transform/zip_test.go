@@ -0,0 +1,145 @@
+package transform
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tueftler/doget/config"
+	"github.com/tueftler/doget/use"
+)
+
+func Test_mkzip_is_reproducible(t *testing.T) {
+	defer workspace(map[string]string{
+		"modules/b/Dockerfile": "FROM debian:jessie\n",
+		"modules/a/Dockerfile": "FROM alpine:3.6\n",
+	}, t)()
+
+	if _, err := mkzip("modules", "first.zip", false); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join("modules", "a", "Dockerfile"), later, later)
+	os.Chmod(filepath.Join("modules", "b", "Dockerfile"), 0600)
+	if _, err := mkzip("modules", "second.zip", false); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	first, _ := ioutil.ReadFile("first.zip")
+	second, _ := ioutil.ReadFile("second.zip")
+	assertEqual(first, second, t)
+}
+
+func Test_mkzip_entries(t *testing.T) {
+	defer workspace(map[string]string{
+		"modules/b/Dockerfile":        "FROM debian:jessie\n",
+		"modules/a/Dockerfile":        "FROM alpine:3.6\n",
+		"modules/a.archive.part":      "PK",
+		"modules/a.archive.part.meta": "uri: x\n",
+	}, t)()
+
+	if _, err := mkzip("modules", "modules.zip", false); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	r, err := zip.OpenReader("modules.zip")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer r.Close()
+
+	names := make([]string, 0)
+	for _, f := range r.File {
+		names = append(names, f.Name)
+		assertEqual(epoch, f.Modified.UTC(), t)
+	}
+	assertEqual([]string{"modules/", "modules/a/", "modules/a/Dockerfile", "modules/b/", "modules/b/Dockerfile"}, names, t)
+}
+
+func Test_mkzip_skips_unchanged(t *testing.T) {
+	defer workspace(map[string]string{"modules/a/Dockerfile": "FROM alpine:3.6\n"}, t)()
+
+	for _, expected := range []bool{true, false} {
+		written, err := mkzip("modules", "modules.zip", true)
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		assertEqual(expected, written, t)
+	}
+
+	ioutil.WriteFile(filepath.Join("modules", "a", "Dockerfile"), []byte("FROM alpine:3.7\n"), 0644)
+	written, _ := mkzip("modules", "modules.zip", true)
+	assertEqual(true, written, t)
+
+	temporary, _ := filepath.Glob(".modules.zip.*")
+	assertEqual(0, len(temporary), t)
+}
+
+func Test_mkzip_roundtrip(t *testing.T) {
+	defer workspace(map[string]string{"modules/a/Dockerfile": "FROM alpine:3.6\n"}, t)()
+
+	if _, err := mkzip("modules", "modules.zip", false); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	if err := unzip("modules.zip", "out", "", ""); err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	content, _ := ioutil.ReadFile(filepath.Join("out", "modules", "a", "Dockerfile"))
+	assertEqual("FROM alpine:3.6\n", string(content), t)
+}
+
+func Test_mkzip_without_source(t *testing.T) {
+	defer workspace(map[string]string{}, t)()
+
+	if _, err := mkzip("modules", "modules.zip", false); err != nil {
+		t.Error(err.Error())
+	}
+}
+
+func Test_mkzip_unchanged_by_revalidation(t *testing.T) {
+	defer workspace(map[string]string{}, t)()
+
+	content := archive(map[string]string{"x-master/Dockerfile": "FROM debian:jessie\n"}, t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if `"v1"` == r.Header.Get("If-None-Match") {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	origin := &use.Origin{Host: "github.com", Vendor: "a", Name: "x", Version: "master", Uri: server.URL + "/x.zip", Prefix: "*/"}
+	archives := make([][]byte, 0)
+	for _, from := range []string{"downloaded", "revalidated"} {
+		fetched, err := (&Fetcher{UseCache: true, Client: anonymous(t), Revalidate: 0}).Fetch(origin, storage(config.Vendordir, origin), "")
+		if err != nil {
+			t.Error(err.Error())
+			return
+		}
+		assertEqual(from, fetched.From[0:len(from)], t)
+
+		if _, err := mkzip(config.Vendordir, config.Vendordir+".zip", false); err != nil {
+			t.Error(err.Error())
+			return
+		}
+		bytes, _ := ioutil.ReadFile(config.Vendordir + ".zip")
+		archives = append(archives, bytes)
+	}
+	assertEqual(archives[0], archives[1], t)
+}
@@ -14,13 +14,49 @@ import (
 type Configuration struct {
 	Source       string
 	Repositories map[string]map[string]string `yaml:"repositories"`
+	Cache        string                       `yaml:"cache"`
+	Vendor       string                       `yaml:"vendor"`
+	Storage      string                       `yaml:"storage"`
+	Offline      bool                         `yaml:"offline"`
+	VendorUrls   bool                         `yaml:"vendor-urls"`
+	Replace      map[string]string            `yaml:"replace"`
+	Credentials  map[string]*Credential       `yaml:"credentials"`
+	Http         Http                         `yaml:"http"`
 }
 
-// Vendordir depicts the basename of the directory where downloaded traits are stored
+// Http configures how traits are downloaded: timeouts, backoff and the interval after
+// which traits fetched from branches are revalidated are given as durations, e.g. "10s",
+// the maximum size of downloads e.g. as "100MB", proxies per host either as URL or "direct"
+type Http struct {
+	ConnectTimeout string            `yaml:"connect-timeout"`
+	ReadTimeout    string            `yaml:"read-timeout"`
+	Retries        *int              `yaml:"retries"`
+	Backoff        string            `yaml:"backoff"`
+	Revalidate     string            `yaml:"revalidate"`
+	MaxSize        string            `yaml:"max-size"`
+	CABundle       string            `yaml:"ca-bundle"`
+	Proxies        map[string]string `yaml:"proxies"`
+}
+
+// Credential holds the credentials for a given host: either a bearer token or username
+// and password for basic authentication, and additional headers. Values of the form
+// $NAME or ${NAME} are taken from the environment
+type Credential struct {
+	Token    string            `yaml:"token"`
+	Username string            `yaml:"username"`
+	Password string            `yaml:"password"`
+	Headers  map[string]string `yaml:"headers"`
+}
+
+// Vendordir depicts the default directory where downloaded traits are stored
 const Vendordir string = "doget_modules"
 
+// Lockfile depicts the name of the file where resolved trait revisions and their hashes are recorded
+const Lockfile string = "doget.lock"
+
 var (
 	search = []func() string{
+		func() string { return "doget.yml" },
 		func() string { return ".doget.yml" },
 		func() string { return filepath.Join(filepath.Dir(os.Args[0]), ".doget.yml") },
 		func() string { return filepath.Join(os.Getenv("HOME"), ".doget.yml") },
@@ -30,17 +66,19 @@ var (
 
 // Empty configuration
 func Empty() *Configuration {
-	return &Configuration{Source: "", Repositories: make(map[string]map[string]string)}
+	return &Configuration{Source: "", Repositories: make(map[string]map[string]string), Replace: make(map[string]string), Credentials: make(map[string]*Credential)}
 }
 
 // Default configuration supports github.com and bitbucket.org
 func Default() *Configuration {
-	return &Configuration{Source: "<default>", Repositories: map[string]map[string]string{
+	return &Configuration{Source: "<default>", Replace: make(map[string]string), Credentials: make(map[string]*Credential), Repositories: map[string]map[string]string{
 		"github.com": map[string]string{
-			"url": "https://github.com/{{.Vendor}}/{{.Name}}/archive/{{.Version}}.zip",
+			"url":  "https://github.com/{{.Vendor}}/{{.Name}}/archive/{{.Version}}.zip",
+			"tags": "https://api.github.com/repos/{{.Vendor}}/{{.Name}}/tags?per_page=100",
 		},
 		"bitbucket.org": map[string]string{
-			"url": "https://bitbucket.org/{{.Vendor}}/{{.Name}}/get/{{.Version}}.zip",
+			"url":  "https://bitbucket.org/{{.Vendor}}/{{.Name}}/get/{{.Version}}.zip",
+			"tags": "https://api.bitbucket.org/2.0/repositories/{{.Vendor}}/{{.Name}}/refs/tags?pagelen=100",
 		},
 	}}
 }
@@ -92,6 +130,28 @@ func (c *Configuration) merge(must bool, sources ...string) (*Configuration, err
 		for host, config := range parsedFile.Repositories {
 			c.Repositories[host] = config
 		}
+		if "" != parsedFile.Cache {
+			c.Cache = parsedFile.Cache
+		}
+		if "" != parsedFile.Vendor {
+			c.Vendor = parsedFile.Vendor
+		}
+		if "" != parsedFile.Storage {
+			c.Storage = parsedFile.Storage
+		}
+		if parsedFile.Offline {
+			c.Offline = true
+		}
+		if parsedFile.VendorUrls {
+			c.VendorUrls = true
+		}
+		for reference, replacement := range parsedFile.Replace {
+			c.Replace[reference] = replacement
+		}
+		for host, credential := range parsedFile.Credentials {
+			c.Credentials[host] = credential
+		}
+		c.Http.merge(&parsedFile.Http)
 	}
 
 	if 0 == len(parsed) && must {
@@ -102,6 +162,70 @@ func (c *Configuration) merge(must bool, sources ...string) (*Configuration, err
 	return c, nil
 }
 
+func (h *Http) merge(other *Http) {
+	if "" != other.ConnectTimeout {
+		h.ConnectTimeout = other.ConnectTimeout
+	}
+	if "" != other.ReadTimeout {
+		h.ReadTimeout = other.ReadTimeout
+	}
+	if nil != other.Retries {
+		h.Retries = other.Retries
+	}
+	if "" != other.Backoff {
+		h.Backoff = other.Backoff
+	}
+	if "" != other.Revalidate {
+		h.Revalidate = other.Revalidate
+	}
+	if "" != other.MaxSize {
+		h.MaxSize = other.MaxSize
+	}
+	if "" != other.CABundle {
+		h.CABundle = other.CABundle
+	}
+	for host, proxy := range other.Proxies {
+		if nil == h.Proxies {
+			h.Proxies = make(map[string]string)
+		}
+		h.Proxies[host] = proxy
+	}
+}
+
+// VendorDir returns the directory where downloaded traits are stored, defaulting to Vendordir
+func (c *Configuration) VendorDir() string {
+	if "" != c.Vendor {
+		return c.Vendor
+	}
+	return Vendordir
+}
+
+// StorageFormat returns the format the vendor directory is stored in, defaulting to zip
+func (c *Configuration) StorageFormat() string {
+	if "" != c.Storage {
+		return c.Storage
+	}
+	return "zip"
+}
+
+// CacheDir returns the directory of the shared trait cache, or an empty string if it is disabled,
+// which it is unless configured via `cache`. Use `cache: default` for $XDG_CACHE_HOME/doget (Un*x)
+// or %LOCALAPPDATA%\Doget\cache (Windows), and `cache: none` to disable a globally configured one.
+func (c *Configuration) CacheDir() string {
+	switch {
+	case "" == c.Cache, "none" == c.Cache:
+		return ""
+	case "default" != c.Cache:
+		return c.Cache
+	case "" != os.Getenv("XDG_CACHE_HOME"):
+		return filepath.Join(os.Getenv("XDG_CACHE_HOME"), "doget")
+	case "" != os.Getenv("LOCALAPPDATA"):
+		return filepath.Join(os.Getenv("LOCALAPPDATA"), "Doget", "cache")
+	default:
+		return filepath.Join(os.Getenv("HOME"), ".cache", "doget")
+	}
+}
+
 // FromFile Reads configuration from a given file
 func FromFile(filename string) (result *Configuration, err error) {
 	result = &Configuration{Source: "", Repositories: make(map[string]map[string]string)}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -34,7 +35,7 @@ func configFile(content string) (*os.File, error) {
 
 func Test_search_path(t *testing.T) {
 	path := SearchPath()
-	assertEqual(4, len(path), t)
+	assertEqual(5, len(path), t)
 }
 
 func Test_empty_source(t *testing.T) {
@@ -203,3 +204,144 @@ repositories:
 	config, _ := Empty().Merge(global.Name(), user.Name())
 	assertEqual("https://github.example.com/...", config.Repositories["github.com"]["url"], t)
 }
+
+func Test_cache_dir_disabled_by_default(t *testing.T) {
+	assertEqual("", Default().CacheDir(), t)
+}
+
+func Test_default_cache_dir_in_xdg_cache_home(t *testing.T) {
+	previous := os.Getenv("XDG_CACHE_HOME")
+	defer os.Setenv("XDG_CACHE_HOME", previous)
+
+	os.Setenv("XDG_CACHE_HOME", "/var/cache")
+	config := Default()
+	config.Cache = "default"
+	assertEqual("/var/cache/doget", filepath.ToSlash(config.CacheDir()), t)
+}
+
+func Test_cache_dir_disabled(t *testing.T) {
+	config := Default()
+	config.Cache = "none"
+	assertEqual("", config.CacheDir(), t)
+}
+
+func Test_overwriting_cache_dir(t *testing.T) {
+	file, err := configFile("cache: /tmp/doget")
+	if err != nil {
+		t.Errorf("Cannot create config file: %s", err.Error())
+		return
+	}
+	defer os.Remove(file.Name())
+
+	config, _ := Default().Merge(file.Name())
+	assertEqual("/tmp/doget", config.CacheDir(), t)
+}
+
+func Test_vendor_dir_defaults_to_doget_modules(t *testing.T) {
+	assertEqual("doget_modules", Default().VendorDir(), t)
+}
+
+func Test_overwriting_vendor_dir_and_storage(t *testing.T) {
+	file, err := configFile("vendor: third_party/traits\nstorage: dir")
+	if err != nil {
+		t.Errorf("Cannot create config file: %s", err.Error())
+		return
+	}
+	defer os.Remove(file.Name())
+
+	config, _ := Default().Merge(file.Name())
+	assertEqual("third_party/traits", config.VendorDir(), t)
+	assertEqual("dir", config.Storage, t)
+}
+
+func Test_offline_defaults_to_false(t *testing.T) {
+	assertEqual(false, Default().Offline, t)
+}
+
+func Test_enabling_offline(t *testing.T) {
+	file, err := configFile("offline: true")
+	if err != nil {
+		t.Errorf("Cannot create config file: %s", err.Error())
+		return
+	}
+	defer os.Remove(file.Name())
+
+	config, _ := Default().Merge(file.Name())
+	assertEqual(true, config.Offline, t)
+}
+
+func Test_vendor_urls_defaults_to_false(t *testing.T) {
+	assertEqual(false, Default().VendorUrls, t)
+}
+
+func Test_enabling_vendor_urls(t *testing.T) {
+	file, err := configFile("vendor-urls: true")
+	if err != nil {
+		t.Errorf("Cannot create config file: %s", err.Error())
+		return
+	}
+	defer os.Remove(file.Name())
+
+	config, _ := Default().Merge(file.Name())
+	assertEqual(true, config.VendorUrls, t)
+}
+
+func Test_replace_defaults_to_empty(t *testing.T) {
+	assertEqual(0, len(Default().Replace), t)
+}
+
+func Test_merging_replacements(t *testing.T) {
+	global, err := configFile("replace:\n  github.com/acme/traits/php: ../traits/php\n  github.com/acme/traits/node: github.com/fork/traits/node\n")
+	if err != nil {
+		t.Errorf("Cannot create config file: %s", err.Error())
+		return
+	}
+	defer os.Remove(global.Name())
+
+	project, err := configFile("replace:\n  github.com/acme/traits/node: ./node\n")
+	if err != nil {
+		t.Errorf("Cannot create config file: %s", err.Error())
+		return
+	}
+	defer os.Remove(project.Name())
+
+	config, _ := Default().Merge(global.Name(), project.Name())
+	assertEqual(map[string]string{"github.com/acme/traits/php": "../traits/php", "github.com/acme/traits/node": "./node"}, config.Replace, t)
+}
+
+func Test_merging_credentials(t *testing.T) {
+	file, err := configFile("credentials:\n  api.github.com:\n    token: $GITHUB_TOKEN\n  git.example.com:\n    username: deploy\n    password: ${GIT_PASSWORD}\n    headers:\n      Private-Token: secret\n")
+	if err != nil {
+		t.Errorf("Cannot create config file: %s", err.Error())
+		return
+	}
+	defer os.Remove(file.Name())
+
+	config, _ := Default().Merge(file.Name())
+	assertEqual(&Credential{Token: "$GITHUB_TOKEN"}, config.Credentials["api.github.com"], t)
+	assertEqual(&Credential{Username: "deploy", Password: "${GIT_PASSWORD}", Headers: map[string]string{"Private-Token": "secret"}}, config.Credentials["git.example.com"], t)
+}
+
+func Test_merging_http_settings(t *testing.T) {
+	global, err := configFile("http:\n  connect-timeout: 5s\n  retries: 5\n  proxies:\n    github.com: http://proxy.example.com:3128\n")
+	if err != nil {
+		t.Errorf("Cannot create config file: %s", err.Error())
+		return
+	}
+	defer os.Remove(global.Name())
+
+	project, err := configFile("http:\n  retries: 0\n  revalidate: 10m\n  max-size: 100MB\n  ca-bundle: /etc/ssl/corporate.pem\n  proxies:\n    git.example.com: direct\n")
+	if err != nil {
+		t.Errorf("Cannot create config file: %s", err.Error())
+		return
+	}
+	defer os.Remove(project.Name())
+
+	config, _ := Default().Merge(global.Name(), project.Name())
+	assertEqual("5s", config.Http.ConnectTimeout, t)
+	assertEqual(0, *config.Http.Retries, t)
+	assertEqual("10m", config.Http.Revalidate, t)
+	assertEqual("100MB", config.Http.MaxSize, t)
+	assertEqual("/etc/ssl/corporate.pem", config.Http.CABundle, t)
+	assertEqual(map[string]string{"github.com": "http://proxy.example.com:3128", "git.example.com": "direct"}, config.Http.Proxies, t)
+}
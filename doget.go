@@ -7,6 +7,7 @@ import (
 
 	"github.com/tueftler/doget/command"
 	"github.com/tueftler/doget/command/build"
+	"github.com/tueftler/doget/command/cache"
 	"github.com/tueftler/doget/command/clean"
 	"github.com/tueftler/doget/command/dump"
 	"github.com/tueftler/doget/command/transform"
@@ -22,12 +23,14 @@ var (
 	version  = "1.0.4-dev"
 )
 
-func init() {
+func register(configuration *config.Configuration) {
 	commands["dump"] = dump.NewCommand("dump")
-	commands["transform"] = transform.NewCommand("transform")
-	commands["clean"] = clean.NewCommand("clean")
+	commands["transform"] = transform.NewCommand("transform", configuration)
+	commands["clean"] = clean.NewCommand("clean", configuration)
+	commands["cache"] = cache.NewCommand("cache", configuration)
 	commands["build"] = build.NewCommand(
 		"build",
+		configuration,
 		commands["transform"],
 		commands["clean"],
 		docker.Create("docker"),
@@ -44,7 +47,7 @@ func configuration(file string) (*config.Configuration, error) {
 
 func main() {
 	var (
-		cmdName    = flag.String("#1", "", "Command, one of [build, clean, dump, transform]")
+		cmdName    = flag.String("#1", "", "Command, one of [build, cache, clean, dump, transform]")
 		configFile = flag.String("config", "", "Configuration file to use")
 	)
 	flag.Parse()
@@ -55,6 +58,7 @@ func main() {
 		os.Exit(1)
 	}
 
+	register(configuration)
 	*cmdName = flag.Arg(0)
 	if delegate, ok := commands[*cmdName]; ok {
 		parser := dockerfile.NewParser().
@@ -0,0 +1,102 @@
+package flock
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Lock is an advisory lock on a file, which contains the PID of the process holding it
+type Lock struct {
+	path string
+	file *os.File
+}
+
+// Locks held by this process and how often they were acquired, allowing nested use
+var (
+	held  = make(map[string]*Lock)
+	count = make(map[string]int)
+	mutex sync.Mutex
+)
+
+// Acquire acquires the lock on the given file, creating it if necessary. If another process
+// holds the lock, waiting is invoked with its PID and the lock is waited for. Locks already
+// held by this process are reentrant.
+func Acquire(file string, waiting func(pid int)) (*Lock, error) {
+	path, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if lock, ok := held[path]; ok {
+		count[path]++
+		return lock, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	acquired, err := trylock(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	} else if !acquired {
+		if nil != waiting {
+			waiting(holder(path))
+		}
+		if err := lock(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	if err := f.Truncate(0); err != nil {
+		unlock(f)
+		f.Close()
+		return nil, err
+	}
+	fmt.Fprintf(f, "%d\n", os.Getpid())
+
+	held[path] = &Lock{path: path, file: f}
+	count[path] = 1
+	return held[path], nil
+}
+
+// Release releases the lock once it was released as often as it was acquired
+func (l *Lock) Release() error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if count[l.path]--; count[l.path] > 0 {
+		return nil
+	}
+
+	delete(held, l.path)
+	delete(count, l.path)
+	err := unlock(l.file)
+	l.file.Close()
+	return err
+}
+
+// holder returns the PID written to a lock file, or -1 if it cannot be determined
+func holder(path string) int {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return -1
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return -1
+	}
+	return pid
+}
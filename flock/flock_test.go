@@ -0,0 +1,100 @@
+package flock
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func assertEqual(expect, actual interface{}, t *testing.T) {
+	if !reflect.DeepEqual(expect, actual) {
+		t.Errorf("Items not equal:\nexpected %q\nhave     %q\n", expect, actual)
+	}
+}
+
+func tempFile(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "flock")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return filepath.Join(dir, "test.lck"), func() { os.RemoveAll(dir) }
+}
+
+func Test_acquire_writes_pid(t *testing.T) {
+	file, cleanup := tempFile(t)
+	defer cleanup()
+
+	lock, err := Acquire(file, nil)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	defer lock.Release()
+
+	assertEqual(os.Getpid(), holder(file), t)
+}
+
+func Test_acquire_is_reentrant(t *testing.T) {
+	file, cleanup := tempFile(t)
+	defer cleanup()
+
+	outer, err := Acquire(file, nil)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	inner, err := Acquire(file, func(pid int) { t.Errorf("Waiting for own lock held by %d", pid) })
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	inner.Release()
+	assertEqual(1, count[outer.file.Name()], t)
+	outer.Release()
+	assertEqual(0, len(held), t)
+}
+
+func Test_acquire_waits_for_other_process(t *testing.T) {
+	if "" != os.Getenv("FLOCK_HOLD") {
+		lock, err := Acquire(os.Getenv("FLOCK_HOLD"), nil)
+		if err != nil {
+			os.Exit(1)
+		}
+		os.Stdout.WriteString("locked\n")
+		time.Sleep(500 * time.Millisecond)
+		lock.Release()
+		os.Exit(0)
+	}
+
+	file, cleanup := tempFile(t)
+	defer cleanup()
+
+	// Start a process holding the lock and wait for it to have acquired it
+	cmd := exec.Command(os.Args[0], "-test.run=Test_acquire_waits_for_other_process")
+	cmd.Env = append(os.Environ(), "FLOCK_HOLD="+file)
+	out, _ := cmd.StdoutPipe()
+	if err := cmd.Start(); err != nil {
+		t.Skip(err.Error())
+	}
+	buf := make([]byte, 7)
+	if _, err := out.Read(buf); err != nil || !strings.HasPrefix(string(buf), "locked") {
+		t.Fatalf("Child did not acquire lock: %q", buf)
+	}
+
+	waited := -1
+	lock, err := Acquire(file, func(pid int) { waited = pid })
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	lock.Release()
+	cmd.Wait()
+
+	assertEqual(cmd.Process.Pid, waited, t)
+}
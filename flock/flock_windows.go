@@ -0,0 +1,49 @@
+package flock
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	lockfileFailImmediately = 0x00000001
+	lockfileExclusiveLock   = 0x00000002
+	errorLockViolation      = syscall.Errno(33)
+)
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+func lockFileEx(f *os.File, flags uint32) error {
+	overlapped := &syscall.Overlapped{}
+	r, _, err := procLockFileEx.Call(f.Fd(), uintptr(flags), 0, 1, 0, uintptr(unsafe.Pointer(overlapped)))
+	if 0 == r {
+		return err
+	}
+	return nil
+}
+
+func trylock(f *os.File) (bool, error) {
+	err := lockFileEx(f, lockfileExclusiveLock|lockfileFailImmediately)
+	if err == errorLockViolation {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func lock(f *os.File) error {
+	return lockFileEx(f, lockfileExclusiveLock)
+}
+
+func unlock(f *os.File) error {
+	overlapped := &syscall.Overlapped{}
+	r, _, err := procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(overlapped)))
+	if 0 == r {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package semver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version represents a semantic version, e.g. v1.2.3 or 1.2.3-rc1
+type Version struct {
+	Major    int
+	Minor    int
+	Patch    int
+	Pre      string
+	Original string
+	parts    int
+}
+
+// Constraint represents a set of comparisons a version must satisfy
+type Constraint struct {
+	Original    string
+	comparisons []comparison
+}
+
+type comparison struct {
+	operator string
+	version  *Version
+}
+
+// Parse parses a version. The leading "v" as well as minor and patch are optional
+func Parse(input string) (*Version, error) {
+	version := &Version{Original: input}
+
+	numbers := strings.TrimPrefix(input, "v")
+	if pos := strings.Index(numbers, "-"); pos != -1 {
+		version.Pre = numbers[pos+1 : len(numbers)]
+		numbers = numbers[0:pos]
+	}
+
+	parts := strings.Split(numbers, ".")
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("Malformed version %q", input)
+	}
+
+	for i, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 {
+			return nil, fmt.Errorf("Malformed version %q", input)
+		}
+
+		switch i {
+		case 0:
+			version.Major = number
+		case 1:
+			version.Minor = number
+		case 2:
+			version.Patch = number
+		}
+	}
+
+	version.parts = len(parts)
+	return version, nil
+}
+
+// Compare returns -1 if this version is lower than the given one, 1 if it is higher, 0 if they're equal
+func (v *Version) Compare(other *Version) int {
+	for _, diff := range []int{v.Major - other.Major, v.Minor - other.Minor, v.Patch - other.Patch} {
+		if diff < 0 {
+			return -1
+		} else if diff > 0 {
+			return 1
+		}
+	}
+
+	// A pre-release version has a lower precedence than the associated normal version
+	switch {
+	case v.Pre == other.Pre:
+		return 0
+	case "" == v.Pre:
+		return 1
+	case "" == other.Pre:
+		return -1
+	case v.Pre < other.Pre:
+		return -1
+	default:
+		return 1
+	}
+}
+
+// String creates a string representation of a version
+func (v *Version) String() string {
+	str := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if "" != v.Pre {
+		str += "-" + v.Pre
+	}
+	return str
+}
+
+// IsConstraint returns whether a given version reference is a constraint,
+// e.g. "^1.2", "~1.4.0" or ">=1.2,<1.5"
+func IsConstraint(input string) bool {
+	return "" != input && strings.ContainsAny(input[0:1], "^~<>=")
+}
+
+// ParseConstraint parses a constraint. Multiple constraints may be combined using commas
+func ParseConstraint(input string) (*Constraint, error) {
+	constraint := &Constraint{Original: input}
+	for _, part := range strings.Split(input, ",") {
+		part = strings.TrimSpace(part)
+		operator := part[0 : len(part)-len(strings.TrimLeft(part, "^~<>="))]
+
+		version, err := Parse(part[len(operator):len(part)])
+		if err != nil {
+			return nil, fmt.Errorf("Malformed constraint %q: %s", input, err.Error())
+		}
+
+		switch operator {
+		case "^":
+			constraint.comparisons = append(constraint.comparisons, comparison{">=", version}, comparison{"<", caret(version)})
+
+		case "~":
+			constraint.comparisons = append(constraint.comparisons, comparison{">=", version}, comparison{"<", tilde(version)})
+
+		case ">=", ">", "<=", "<", "=":
+			constraint.comparisons = append(constraint.comparisons, comparison{operator, version})
+
+		case "":
+			constraint.comparisons = append(constraint.comparisons, comparison{"=", version})
+
+		default:
+			return nil, fmt.Errorf("Malformed constraint %q: unknown operator %q", input, operator)
+		}
+	}
+
+	return constraint, nil
+}
+
+// Matches returns whether a given version satisfies this constraint. Pre-release
+// versions only match if the constraint explicitly references one.
+func (c *Constraint) Matches(version *Version) bool {
+	for _, comparison := range c.comparisons {
+		if "" != version.Pre && "" == comparison.version.Pre {
+			return false
+		}
+
+		result := version.Compare(comparison.version)
+		switch comparison.operator {
+		case ">=":
+			if result < 0 {
+				return false
+			}
+		case ">":
+			if result <= 0 {
+				return false
+			}
+		case "<=":
+			if result > 0 {
+				return false
+			}
+		case "<":
+			if result >= 0 {
+				return false
+			}
+		case "=":
+			if result != 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Highest returns the highest of the given tags matching this constraint
+func (c *Constraint) Highest(tags []string) (string, bool) {
+	var highest *Version
+	for _, tag := range tags {
+		version, err := Parse(tag)
+		if err != nil || !c.Matches(version) {
+			continue
+		}
+
+		if nil == highest || version.Compare(highest) > 0 {
+			highest = version
+		}
+	}
+
+	if nil == highest {
+		return "", false
+	}
+	return highest.Original, true
+}
+
+// String creates a string representation of a constraint
+func (c *Constraint) String() string {
+	return c.Original
+}
+
+// caret returns the upper bound for "^", allowing changes that do not modify
+// the left-most non-zero component: ^1.2.3 := <2.0.0, ^0.2.3 := <0.3.0
+func caret(version *Version) *Version {
+	switch {
+	case version.Major > 0 || version.parts == 1:
+		return &Version{Major: version.Major + 1}
+	case version.Minor > 0 || version.parts == 2:
+		return &Version{Minor: version.Minor + 1}
+	default:
+		return &Version{Patch: version.Patch + 1}
+	}
+}
+
+// tilde returns the upper bound for "~", allowing patch-level changes if a minor
+// version is specified, minor-level changes if not: ~1.2.3 := <1.3.0, ~1 := <2.0.0
+func tilde(version *Version) *Version {
+	if version.parts == 1 {
+		return &Version{Major: version.Major + 1}
+	}
+	return &Version{Major: version.Major, Minor: version.Minor + 1}
+}
@@ -0,0 +1,143 @@
+package semver
+
+import (
+	"reflect"
+	"testing"
+)
+
+func assertEqual(expect, actual interface{}, t *testing.T) {
+	if !reflect.DeepEqual(expect, actual) {
+		t.Errorf("Items not equal:\nexpected %q\nhave     %q\n", expect, actual)
+	}
+}
+
+func mustParse(input string) *Version {
+	version, err := Parse(input)
+	if err != nil {
+		panic(err)
+	}
+	return version
+}
+
+func mustParseConstraint(input string) *Constraint {
+	constraint, err := ParseConstraint(input)
+	if err != nil {
+		panic(err)
+	}
+	return constraint
+}
+
+var versions = []struct {
+	input  string
+	expect string
+}{
+	{"1.2.3", "1.2.3"},
+	{"v1.2.3", "1.2.3"},
+	{"v1.2", "1.2.0"},
+	{"1", "1.0.0"},
+	{"v1.0.0-rc1", "1.0.0-rc1"},
+}
+
+func Test_parse(t *testing.T) {
+	for _, tt := range versions {
+		assertEqual(tt.expect, mustParse(tt.input).String(), t)
+	}
+}
+
+func Test_parse_malformed(t *testing.T) {
+	for _, input := range []string{"", "master", "1.2.3.4", "v1.x", "1.-2"} {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("Expected an error for %q, have none", input)
+		}
+	}
+}
+
+var comparisons = []struct {
+	a, b   string
+	expect int
+}{
+	{"1.0.0", "1.0.0", 0},
+	{"v1.0.0", "1.0.0", 0},
+	{"1.0.0", "1.0.1", -1},
+	{"1.1.0", "1.0.9", 1},
+	{"2.0.0", "1.9.9", 1},
+	{"1.0.0-rc1", "1.0.0", -1},
+	{"1.0.0-rc1", "1.0.0-rc2", -1},
+}
+
+func Test_compare(t *testing.T) {
+	for _, tt := range comparisons {
+		assertEqual(tt.expect, mustParse(tt.a).Compare(mustParse(tt.b)), t)
+	}
+}
+
+var constraints = []struct {
+	input string
+	valid bool
+}{
+	{"^1.2", true},
+	{"~1.4.0", true},
+	{">=1.2,<1.5", true},
+	{"=1.0.0", true},
+	{"master", false},
+	{"v1.0.0", false},
+	{"", false},
+}
+
+func Test_is_constraint(t *testing.T) {
+	for _, tt := range constraints {
+		assertEqual(tt.valid, IsConstraint(tt.input), t)
+	}
+}
+
+func Test_malformed_constraint(t *testing.T) {
+	for _, input := range []string{"^", "~x", "=>1.0", ">=1.0,"} {
+		if _, err := ParseConstraint(input); err == nil {
+			t.Errorf("Expected an error for %q, have none", input)
+		}
+	}
+}
+
+var matches = []struct {
+	constraint string
+	version    string
+	expect     bool
+}{
+	{"^1.2", "1.2.0", true},
+	{"^1.2", "1.9.9", true},
+	{"^1.2", "1.1.9", false},
+	{"^1.2", "2.0.0", false},
+	{"^0.2.3", "0.2.9", true},
+	{"^0.2.3", "0.3.0", false},
+	{"^0.0.3", "0.0.4", false},
+	{"~1.4.0", "1.4.9", true},
+	{"~1.4.0", "1.5.0", false},
+	{"~1", "1.9.0", true},
+	{"~1", "2.0.0", false},
+	{">=1.2,<1.5", "1.4.9", true},
+	{">=1.2,<1.5", "1.5.0", false},
+	{"=1.0.0", "v1.0.0", true},
+	{">1.0.0", "1.0.0", false},
+	{"<=1.0.0", "1.0.0", true},
+	{"^1.0", "1.1.0-rc1", false},
+	{">=1.1.0-rc1", "1.1.0-rc2", true},
+}
+
+func Test_matches(t *testing.T) {
+	for _, tt := range matches {
+		if tt.expect != mustParseConstraint(tt.constraint).Matches(mustParse(tt.version)) {
+			t.Errorf("Expected %s matching %s to be %v", tt.constraint, tt.version, tt.expect)
+		}
+	}
+}
+
+func Test_highest(t *testing.T) {
+	tag, ok := mustParseConstraint("^1.2").Highest([]string{"v1.1.0", "v1.2.0", "master", "v1.10.1", "v1.9.0", "v2.0.0"})
+	assertEqual(true, ok, t)
+	assertEqual("v1.10.1", tag, t)
+}
+
+func Test_highest_without_match(t *testing.T) {
+	_, ok := mustParseConstraint("^3.0").Highest([]string{"v1.1.0", "v2.0.0"})
+	assertEqual(false, ok, t)
+}
@@ -4,10 +4,15 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"text/template"
 
 	"github.com/tueftler/doget/dockerfile"
+	"github.com/tueftler/doget/semver"
 )
 
 // Statement represents a single USE statement
@@ -24,31 +29,79 @@ type Context struct {
 
 // Origin represents the parsed components of a USE reference
 type Origin struct {
-	Host    string
-	Vendor  string
-	Name    string
-	Version string
-	Dir     string
-	Uri     string
+	Host       string
+	Vendor     string
+	Name       string
+	Version    string
+	Dir        string
+	Uri        string
+	Format     string
+	Prefix     string
+	Digest     string
+	Constraint string
+	Type       string
+	Local      string
+	Relative   bool
 }
 
+// Repository types: archives downloaded via HTTP, git repositories to clone, or
+// single Dockerfiles downloaded via HTTP
+const (
+	Archive = "archive"
+	Git     = "git"
+	Raw     = "raw"
+)
+
+// Archive formats, detected by their contents by default
+const (
+	Auto   = "auto"
+	Zip    = "zip"
+	TarGz  = "tar.gz"
+	TarBz2 = "tar.bz2"
+)
+
+// Defaults for repository settings
+var defaults = map[string]string{
+	"strip": "*/",
+}
+
+var integrity = regexp.MustCompile("^sha256:[0-9a-fA-F]{64}$")
+
 // New creates a USE instruction backed by the given repositories
 func New(repositories map[string]map[string]string) *Context {
 	return &Context{Repositories: repositories}
 }
 
-// String creates a string representation of an origin
-func (o *Origin) String() string {
+// Path returns the origin without its version, identifying a trait
+func (o *Origin) Path() string {
+	if "" != o.Local {
+		return filepath.ToSlash(o.Local)
+	} else if o.Direct() {
+		return o.Uri
+	}
+
 	str := o.Host + "/" + o.Vendor + "/" + o.Name
 	if "" != o.Dir {
 		str += "/" + o.Dir
 	}
+	return str
+}
+
+// String creates a string representation of an origin
+func (o *Origin) String() string {
+	str := o.Path()
 	if "" != o.Version {
 		str += ":" + o.Version
 	}
 	return str
 }
 
+// Direct returns whether the origin was given as a URL, e.g. https://example.com/path/to/Dockerfile,
+// instead of being compiled from a repository's url template
+func (o *Origin) Direct() bool {
+	return "" == o.Name && "" != o.Uri
+}
+
 // Emit writes the USE statement
 func (s *Statement) Emit(out io.Writer) {
 	dockerfile.EmitInstruction(out, "USE", s.Reference)
@@ -59,15 +112,54 @@ func (s *Statement) Origin() (origin *Origin, err error) {
 	var parsed []string
 
 	origin = &Origin{}
+	fields := strings.Fields(s.Reference)
+	if 0 == len(fields) {
+		return nil, fmt.Errorf("Empty reference on line %d", s.Line)
+	}
+
+	// Integrity, e.g. "sha256:[hash]"
+	reference := fields[0]
+	if len(fields) > 2 {
+		return nil, fmt.Errorf("Unexpected %q after reference %s", fields[2:], reference)
+	} else if len(fields) == 2 {
+		if !integrity.MatchString(fields[1]) {
+			return nil, fmt.Errorf("Malformed integrity %q for %s, expected sha256:[hash]", fields[1], reference)
+		}
+		origin.Digest = strings.ToLower(fields[1])
+	}
+
+	// Local traits, e.g. "./traits/php" or "file:///opt/traits/node"
+	if strings.HasPrefix(reference, "file://") {
+		origin.Local = filepath.FromSlash(strings.TrimPrefix(reference, "file://"))
+		return origin, nil
+	} else if strings.HasPrefix(reference, "./") || strings.HasPrefix(reference, "../") {
+		origin.Local = filepath.FromSlash(reference)
+		origin.Relative = true
+		return origin, nil
+	} else if strings.HasPrefix(reference, "http://") || strings.HasPrefix(reference, "https://") {
+		parsed, err := url.Parse(reference)
+		if err != nil {
+			return nil, fmt.Errorf("Malformed reference %s: %s", reference, err.Error())
+		}
+		origin.Host = parsed.Host
+		origin.Dir = strings.Trim(parsed.Path, "/")
+		origin.Type = Raw
+		origin.Uri = reference
+		return origin, nil
+	}
 
 	// Version
-	pos := strings.LastIndex(s.Reference, ":")
+	pos := strings.LastIndex(reference, ":")
 	if pos == -1 {
-		parsed = strings.Split(s.Reference, "/")
+		parsed = strings.Split(reference, "/")
 		origin.Version = "master"
 	} else {
-		parsed = strings.Split(s.Reference[0:pos], "/")
-		origin.Version = s.Reference[pos+1 : len(s.Reference)]
+		parsed = strings.Split(reference[0:pos], "/")
+		origin.Version = reference[pos+1 : len(reference)]
+	}
+
+	if len(parsed) < 3 {
+		return nil, fmt.Errorf("Malformed reference %s, expected domain/vendor/repo[/dir][:version]", reference)
 	}
 
 	origin.Host = parsed[0]
@@ -81,22 +173,162 @@ func (s *Statement) Origin() (origin *Origin, err error) {
 		origin.Dir = ""
 	}
 
+	// Versions and directories are passed to git, refuse anything which could be mistaken for an option
+	if strings.HasPrefix(origin.Version, "-") || strings.HasPrefix(origin.Dir, "-") {
+		return nil, fmt.Errorf("Malformed reference %s, version and dir may not start with \"-\"", reference)
+	}
+
+	// Repository type
+	if origin.Type, err = s.Context.Type(origin); err != nil {
+		return nil, err
+	}
+	if origin.Format, err = s.Context.Format(origin); err != nil {
+		return nil, err
+	}
+
+	// Version constraints, e.g. "^1.2", are resolved against the repository's tags later on
+	if semver.IsConstraint(origin.Version) {
+		if _, err := semver.ParseConstraint(origin.Version); err != nil {
+			return nil, err
+		}
+
+		origin.Constraint = origin.Version
+		return origin, nil
+	}
+
 	// Compile URL
-	if repository, ok := s.Context.Repositories[origin.Host]; ok {
-		template, err := template.New(origin.Host).Parse(repository["url"])
+	if err := s.Context.Resolve(origin, origin.Version); err != nil {
+		return nil, err
+	}
+	return origin, nil
+}
+
+// Within resolves a relative reference against the origin of the trait including
+// it: inside remote traits, it refers to a directory inside the same repository
+// at the same version; otherwise, to a path relative to the given directory.
+func (o *Origin) Within(parent *Origin, dir string) (*Origin, error) {
+	if !o.Relative {
+		return o, nil
+	}
+
+	if nil == parent || "" != parent.Local {
+		return &Origin{Local: filepath.Join(dir, o.Local), Digest: o.Digest}, nil
+	} else if Raw == parent.Type {
+		return nil, fmt.Errorf("Reference %s cannot be resolved inside %s, which consists of its Dockerfile only", filepath.ToSlash(o.Local), parent.String())
+	}
+
+	resolved := *parent
+	resolved.Dir = path.Join(parent.Dir, filepath.ToSlash(o.Local))
+	resolved.Digest = o.Digest
+	resolved.Constraint = ""
+	if "." == resolved.Dir {
+		resolved.Dir = ""
+	} else if ".." == resolved.Dir || strings.HasPrefix(resolved.Dir, "../") {
+		return nil, fmt.Errorf("Reference %s leaves repository %s", filepath.ToSlash(o.Local), parent.String())
+	}
+	return &resolved, nil
+}
+
+// Resolve sets the origin's version, e.g. after resolving its constraint, and compiles its URI
+// as well as the prefix to strip from paths inside its archive
+func (c *Context) Resolve(origin *Origin, version string) error {
+	if origin.Direct() {
+		origin.Version = version
+		return nil
+	}
+
+	resolved := *origin
+	resolved.Version = version
+
+	uri, err := c.Uri(&resolved)
+	if err != nil {
+		return err
+	}
+
+	prefix, err := c.compile("strip", &resolved)
+	if err != nil {
+		return err
+	}
+
+	origin.Version = version
+	origin.Uri = uri
+	origin.Prefix = prefix
+	return nil
+}
+
+// Type returns the type of the repository a given origin is stored in, defaulting to archive
+func (c *Context) Type(origin *Origin) (string, error) {
+	repository, ok := c.Repositories[origin.Host]
+	if !ok {
+		return "", fmt.Errorf("No repository %s", origin.Host)
+	}
+
+	switch repository["type"] {
+	case "", Archive:
+		return Archive, nil
+	case Git, Raw:
+		return repository["type"], nil
+	default:
+		return "", fmt.Errorf("Unknown type %q for repository %s, expected one of [%s, %s, %s]", repository["type"], origin.Host, Archive, Git, Raw)
+	}
+}
+
+// Format returns the archive format of the repository a given origin is stored in
+func (c *Context) Format(origin *Origin) (string, error) {
+	repository, ok := c.Repositories[origin.Host]
+	if !ok {
+		return "", fmt.Errorf("No repository %s", origin.Host)
+	}
+
+	switch repository["format"] {
+	case "", Auto:
+		return Auto, nil
+	case Zip, TarGz, TarBz2:
+		return repository["format"], nil
+	default:
+		return "", fmt.Errorf("Unknown format %q for repository %s, expected one of [%s, %s, %s, %s]", repository["format"], origin.Host, Auto, Zip, TarGz, TarBz2)
+	}
+}
+
+// Uri compiles the download URI for a given origin using its repository's url template
+func (c *Context) Uri(origin *Origin) (string, error) {
+	if origin.Direct() {
+		return origin.Uri, nil
+	}
+	return c.compile("url", origin)
+}
+
+// Tags compiles the URI listing the tags for a given origin using its repository's tags template.
+// Git repositories list their tags themselves, so their url template is used unless given.
+func (c *Context) Tags(origin *Origin) (string, error) {
+	if repository, ok := c.Repositories[origin.Host]; ok && Git == repository["type"] && "" == repository["tags"] {
+		return c.compile("url", origin)
+	} else if ok && "" == repository["tags"] {
+		return "", fmt.Errorf("Repository %s does not support listing tags", origin.Host)
+	}
+	return c.compile("tags", origin)
+}
+
+func (c *Context) compile(key string, origin *Origin) (string, error) {
+	if repository, ok := c.Repositories[origin.Host]; ok {
+		source, ok := repository[key]
+		if !ok {
+			source = defaults[key]
+		}
+
+		template, err := template.New(origin.Host).Parse(source)
 		if err != nil {
-			return nil, err
+			return "", err
 		}
 
 		var uri bytes.Buffer
 		if err := template.Execute(&uri, *origin); err != nil {
-			return nil, err
+			return "", err
 		}
 
-		origin.Uri = uri.String()
-		return origin, nil
+		return uri.String(), nil
 	} else {
-		return nil, fmt.Errorf("No repository %s", origin.Host)
+		return "", fmt.Errorf("No repository %s", origin.Host)
 	}
 }
 
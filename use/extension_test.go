@@ -1,6 +1,7 @@
 package use
 
 import (
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -126,3 +127,252 @@ func Test_origin_with_version(t *testing.T) {
 	}
 	assertEqual("v1.0.0", origin.Version, t)
 }
+
+func Test_uri(t *testing.T) {
+	origin, err := mustParse("USE github.com/thekid/trait:v1.0.0").Origin()
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual("https://github.com/thekid/trait/archive/v1.0.0.zip", origin.Uri, t)
+}
+
+func Test_origin_without_digest(t *testing.T) {
+	origin, err := mustParse("USE github.com/thekid/trait:v1.0.0").Origin()
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual("", origin.Digest, t)
+}
+
+func Test_origin_with_digest(t *testing.T) {
+	origin, err := mustParse("USE github.com/thekid/trait/dir:v1.0.0 sha256:" + strings.Repeat("AB", 32)).Origin()
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual("sha256:"+strings.Repeat("ab", 32), origin.Digest, t)
+	assertEqual("v1.0.0", origin.Version, t)
+	assertEqual("dir", origin.Dir, t)
+}
+
+func Test_origin_with_malformed_digest(t *testing.T) {
+	_, err := mustParse("USE github.com/thekid/trait:v1.0.0 md5:abcd").Origin()
+	if err == nil {
+		t.Error("Expected an error, have none")
+		return
+	}
+	assertEqual("Malformed integrity \"md5:abcd\" for github.com/thekid/trait:v1.0.0, expected sha256:[hash]", err.Error(), t)
+}
+
+func Test_origin_malformed_reference(t *testing.T) {
+	_, err := mustParse("USE github.com/thekid").Origin()
+	if err == nil {
+		t.Error("Expected an error, have none")
+		return
+	}
+	assertEqual("Malformed reference github.com/thekid, expected domain/vendor/repo[/dir][:version]", err.Error(), t)
+}
+
+func Test_origin_rejects_version_looking_like_option(t *testing.T) {
+	_, err := mustParse("USE github.com/thekid/trait:--upload-pack=touch${IFS}/tmp/pwned").Origin()
+	if err == nil {
+		t.Error("Expected an error, have none")
+		return
+	}
+	assertEqual("Malformed reference github.com/thekid/trait:--upload-pack=touch${IFS}/tmp/pwned, version and dir may not start with \"-\"", err.Error(), t)
+}
+
+func Test_origin_rejects_dir_looking_like_option(t *testing.T) {
+	_, err := mustParse("USE github.com/thekid/trait/--output=x:v1.0.0").Origin()
+	if err == nil {
+		t.Error("Expected an error, have none")
+		return
+	}
+	assertEqual("Malformed reference github.com/thekid/trait/--output=x:v1.0.0, version and dir may not start with \"-\"", err.Error(), t)
+}
+
+func Test_origin_path(t *testing.T) {
+	origin, err := mustParse("USE github.com/thekid/trait/sub/dir:v1.0.0").Origin()
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual("github.com/thekid/trait/sub/dir", origin.Path(), t)
+}
+
+func Test_origin_with_constraint(t *testing.T) {
+	origin, err := mustParse("USE github.com/thekid/traits/xp:^1.2").Origin()
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual("^1.2", origin.Constraint, t)
+	assertEqual("", origin.Uri, t)
+}
+
+func Test_origin_with_malformed_constraint(t *testing.T) {
+	_, err := mustParse("USE github.com/thekid/traits/xp:^one").Origin()
+	if err == nil {
+		t.Error("Expected an error, have none")
+	}
+}
+
+func Test_resolve(t *testing.T) {
+	statement := mustParse("USE github.com/thekid/traits/xp:^1.2")
+	origin, err := statement.Origin()
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	if err := statement.Context.Resolve(origin, "v1.2.3"); err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual("github.com/thekid/traits/xp:v1.2.3", origin.String(), t)
+	assertEqual("https://github.com/thekid/traits/archive/v1.2.3.zip", origin.Uri, t)
+}
+
+func Test_tags(t *testing.T) {
+	statement := mustParse("USE github.com/thekid/traits/xp:^1.2")
+	origin, err := statement.Origin()
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+
+	uri, err := statement.Context.Tags(origin)
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual("https://api.github.com/repos/thekid/traits/tags?per_page=100", uri, t)
+}
+
+func Test_origin_relative_path(t *testing.T) {
+	origin, err := mustParse("USE ./traits/php").Origin()
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual(true, origin.Relative, t)
+	assertEqual("./traits/php", filepath.ToSlash(origin.Local), t)
+}
+
+func Test_origin_file_uri(t *testing.T) {
+	origin, err := mustParse("USE file:///opt/traits/node").Origin()
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual(false, origin.Relative, t)
+	assertEqual("/opt/traits/node", origin.Path(), t)
+	assertEqual("/opt/traits/node", origin.String(), t)
+}
+
+func Test_relative_within_local_directory(t *testing.T) {
+	origin, _ := mustParse("USE ../common").Origin()
+	resolved, err := origin.Within(nil, filepath.FromSlash("traits/php"))
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual("traits/common", resolved.Path(), t)
+}
+
+func Test_relative_within_remote_trait(t *testing.T) {
+	parent, _ := mustParse("USE github.com/thekid/traits/php:v1.0.0").Origin()
+	origin, _ := mustParse("USE ../common").Origin()
+	resolved, err := origin.Within(parent, "")
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual("github.com/thekid/traits/common:v1.0.0", resolved.String(), t)
+	assertEqual(parent.Uri, resolved.Uri, t)
+}
+
+func Test_relative_leaving_remote_repository(t *testing.T) {
+	parent, _ := mustParse("USE github.com/thekid/traits/php:v1.0.0").Origin()
+	origin, _ := mustParse("USE ../../other").Origin()
+	_, err := origin.Within(parent, "")
+	assertEqual("Reference ../../other leaves repository github.com/thekid/traits/php:v1.0.0", err.Error(), t)
+}
+
+func Test_origin_type_defaults_to_archive(t *testing.T) {
+	origin, _ := mustParse("USE github.com/thekid/trait").Origin()
+	assertEqual(Archive, origin.Type, t)
+}
+
+func Test_git_repository(t *testing.T) {
+	context := New(map[string]map[string]string{
+		"git.example.com": map[string]string{"type": "git", "url": "https://git.example.com/{{.Vendor}}/{{.Name}}.git"},
+	})
+	origin, err := (&Statement{Context: context, Reference: "git.example.com/thekid/trait:v1.0.0"}).Origin()
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual(Git, origin.Type, t)
+	assertEqual("https://git.example.com/thekid/trait.git", origin.Uri, t)
+
+	tags, _ := context.Tags(origin)
+	assertEqual("https://git.example.com/thekid/trait.git", tags, t)
+}
+
+func Test_unknown_repository_type(t *testing.T) {
+	context := New(map[string]map[string]string{"example.com": map[string]string{"type": "svn"}})
+	_, err := (&Statement{Context: context, Reference: "example.com/thekid/trait"}).Origin()
+	assertEqual("Unknown type \"svn\" for repository example.com, expected one of [archive, git, raw]", err.Error(), t)
+}
+
+func Test_origin_defaults(t *testing.T) {
+	origin, _ := mustParse("USE github.com/thekid/trait:v1.0.0").Origin()
+	assertEqual(Auto, origin.Format, t)
+	assertEqual("*/", origin.Prefix, t)
+}
+
+func Test_origin_format_and_prefix(t *testing.T) {
+	context := New(map[string]map[string]string{
+		"gitlab.example.com": map[string]string{
+			"url":    "https://gitlab.example.com/{{.Vendor}}/{{.Name}}/-/archive/{{.Version}}/{{.Name}}-{{.Version}}.tar.gz",
+			"format": "tar.gz",
+			"strip":  "{{.Name}}-{{.Version}}-*/",
+		},
+	})
+	origin, err := (&Statement{Context: context, Reference: "gitlab.example.com/thekid/trait:v1.0.0"}).Origin()
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual(TarGz, origin.Format, t)
+	assertEqual("trait-v1.0.0-*/", origin.Prefix, t)
+}
+
+func Test_unknown_format(t *testing.T) {
+	context := New(map[string]map[string]string{"example.com": map[string]string{"format": "rar"}})
+	_, err := (&Statement{Context: context, Reference: "example.com/thekid/trait"}).Origin()
+	assertEqual("Unknown format \"rar\" for repository example.com, expected one of [auto, zip, tar.gz, tar.bz2]", err.Error(), t)
+}
+
+func Test_origin_url(t *testing.T) {
+	origin, err := mustParse("USE https://example.com/path/to/Dockerfile").Origin()
+	if err != nil {
+		t.Error(err.Error())
+		return
+	}
+	assertEqual(Raw, origin.Type, t)
+	assertEqual(true, origin.Direct(), t)
+	assertEqual("example.com", origin.Host, t)
+	assertEqual("path/to/Dockerfile", origin.Dir, t)
+	assertEqual("https://example.com/path/to/Dockerfile", origin.String(), t)
+}
+
+func Test_relative_within_raw_trait(t *testing.T) {
+	parent, _ := mustParse("USE https://example.com/path/to/Dockerfile").Origin()
+	origin, _ := mustParse("USE ../common").Origin()
+	_, err := origin.Within(parent, "")
+	assertEqual("Reference ../common cannot be resolved inside https://example.com/path/to/Dockerfile, which consists of its Dockerfile only", err.Error(), t)
+}